@@ -0,0 +1,90 @@
+package bm13xx
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultBaudTolerance is the largest gap between a requested baudrate and the
+// one the chip UART achieves, in percent, for the host and the chips to keep in sync.
+const DefaultBaudTolerance = 5.0
+
+const (
+	fastBaud     = 3000000    // above, the UART clock comes from PLL3
+	fastUARTVCO  = 2800000000 // PLL3 frequency, Hz
+	maxUARTClock = 400000000  // fast UART clock, as PLL3 / (PLL3_DIV4 + 1), Hz
+)
+
+// BaudPlan is a UART clock setting of the chips, baud = UART clock / ((BT8D + 1) * 8).
+type BaudPlan struct {
+	BT8D     uint16
+	BClkSel  bool            // UART clock from PLL3 / (PLL3Div4 + 1) instead of CLKI
+	PLL3     PLLParameterReg // if BClkSel
+	PLL3Div4 byte            // if BClkSel
+	Baud     uint32          // achieved, the one the host port has to switch to
+	Error    float64         // percent from the requested baudrate
+}
+
+// PlanBaudrate returns the UART setting whose baudrate is the closest to baud
+// with a clki Hz reference clock, ErrOutOfRange if not within tolerance percent
+// (DefaultBaudTolerance if 0).
+func (m *ChipModel) PlanBaudrate(clki uint32, baud uint32, tolerance float64) (BaudPlan, error) {
+	if tolerance <= 0 {
+		tolerance = DefaultBaudTolerance
+	}
+	minBaud, maxBaud := uint32(115200), uint32(7000000)
+	if m != nil {
+		minBaud, maxBaud = m.MinBaud, m.MaxBaud
+	}
+	if baud < minBaud || baud > maxBaud {
+		return BaudPlan{}, fmt.Errorf("baudrate %d %w [%d:%d]", baud, ErrOutOfRange, minBaud, maxBaud)
+	}
+	var plan BaudPlan
+	if m == BM1387 {
+		// BT8D is BIT[12:8] only and there is no fast UART
+		plan = planBT8D(clki, baud, 0x1f)
+	} else if baud <= fastBaud {
+		plan = planBT8D(clki, baud, 0x1ff)
+	} else {
+		fbDiv := (fastUARTVCO + uint64(clki)/2) / uint64(clki)
+		if fbDiv == 0 || fbDiv > 0xfff {
+			return BaudPlan{}, fmt.Errorf("PLL3 with a %d Hz clock %w", clki, ErrOutOfRange)
+		}
+		vco := uint64(clki) * fbDiv
+		div4 := (vco + maxUARTClock - 1) / maxUARTClock
+		if div4 > 0x10 {
+			div4 = 0x10
+		}
+		plan = planBT8D(uint32(vco/div4), baud, 0x1ff)
+		plan.BClkSel = true
+		// LOCKED set too, as the reference init writes it
+		plan.PLL3 = PLLParameterReg{Locked: true, PLLEn: true, FBDiv: uint16(fbDiv), RefDiv: 1, PostDiv1: 1, PostDiv2: 1}
+		plan.PLL3Div4 = byte(div4 - 1)
+	}
+	if math.Abs(plan.Error) > tolerance {
+		return plan, fmt.Errorf("baudrate %d %w, %d at best (%+.2f%%)", baud, ErrOutOfRange, plan.Baud, plan.Error)
+	}
+	return plan, nil
+}
+
+// planBT8D returns the divider of uartClk the closest to baud.
+func planBT8D(uartClk uint32, baud uint32, maxBT8D uint16) BaudPlan {
+	var best BaudPlan
+	bestErr := math.Inf(1)
+	floor := uint64(uartClk) / (8 * uint64(baud))
+	for _, div := range []uint64{floor, floor + 1} {
+		if div < 1 {
+			div = 1
+		}
+		if div > uint64(maxBT8D)+1 {
+			div = uint64(maxBT8D) + 1
+		}
+		achieved := uint32(uint64(uartClk) / (8 * div))
+		plan := BaudPlan{BT8D: uint16(div - 1), Baud: achieved,
+			Error: (float64(achieved) - float64(baud)) * 100 / float64(baud)}
+		if math.Abs(plan.Error) < bestErr {
+			best, bestErr = plan, math.Abs(plan.Error)
+		}
+	}
+	return best
+}
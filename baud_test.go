@@ -0,0 +1,57 @@
+package bm13xx
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChipModel_PlanBaudrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   *ChipModel
+		baud    uint32
+		tol     float64
+		want    BaudPlan
+		wantErr error
+	}{
+		{name: "BM1397 115200", model: BM1397, baud: 115200, want: BaudPlan{BT8D: 26, Baud: 115740}},
+		{name: "BM1397 1500000", model: BM1397, baud: 1500000, want: BaudPlan{BT8D: 1, Baud: 1562500}},
+		{name: "BM1397 3125000", model: BM1397, baud: 3125000, want: BaudPlan{BT8D: 15, BClkSel: true,
+			PLL3:     PLLParameterReg{Locked: true, PLLEn: true, FBDiv: 112, RefDiv: 1, PostDiv1: 1, PostDiv2: 1},
+			PLL3Div4: 6, Baud: 3125000}},
+		{name: "BM1387 115200", model: BM1387, baud: 115200, want: BaudPlan{BT8D: 26, Baud: 115740}},
+		{name: "BM1387 out of tolerance", model: BM1387, baud: 2000000, wantErr: ErrOutOfRange},
+		{name: "BM1387 wider tolerance", model: BM1387, baud: 2000000, tol: 25, want: BaudPlan{BT8D: 1, Baud: 1562500}},
+		{name: "too fast", model: BM1397, baud: 8000000, wantErr: ErrOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.model.PlanBaudrate(25000000, tt.baud, tt.tol)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ChipModel.PlanBaudrate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			wantErr := (float64(tt.want.Baud) - float64(tt.baud)) * 100 / float64(tt.baud)
+			if got.Error != wantErr {
+				t.Errorf("ChipModel.PlanBaudrate() error %v%%, want %v%%", got.Error, wantErr)
+			}
+			got.Error = 0
+			if got != tt.want {
+				t.Errorf("ChipModel.PlanBaudrate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChipModel_PlanBaudrate_PLL3(t *testing.T) {
+	plan, err := BM1397.PlanBaudrate(25000000, 3125000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as written by the init before baudrates were planned
+	if got := plan.PLL3.Encode(); got != 0xC0700111 {
+		t.Errorf("PLL3 = 0x%08X, want 0xC0700111", got)
+	}
+}
@@ -1,8 +1,12 @@
 package bm13xx
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -19,8 +23,18 @@ func (n Nonce) Core() byte {
 }
 
 type Asic struct {
-	Regs     map[RegAddr]uint32
+	Model    *ChipModel
+	Regs     map[RegAddr]uint32 // shadow of the registers, see State
 	CoreRegs map[CoreRegID]uint16
+	States   map[RegAddr]RegState
+	Freq     float64 // PLL0 frequency last set, MHz, 0 if never
+}
+
+func (a Asic) ChipID() uint16 {
+	if chipAddress, exist := a.Regs[ChipAddress]; exist {
+		return uint16(chipAddress >> 16)
+	}
+	return 0
 }
 
 func (a Asic) Addr() byte {
@@ -40,107 +54,284 @@ func (a Asic) CoreNum() byte {
 func (a Asic) PllFreq(pll int, clki uint32) (uint32, error) {
 	pllParams := []RegAddr{PLL0Parameter, PLL1Parameter, PLL2Parameter, PLL3Parameter}
 	if pll >= len(pllParams) || pll < 0 {
-		return 0, fmt.Errorf("pll %d out of range", pll)
-	}
-	if pllParam, exist := a.Regs[pllParams[pll]]; exist {
-		pllLocked := (pllParam >> 31) & 0x01
-		pllEn := (pllParam >> 30) & 0x01
-		if pllLocked == 0 || pllEn == 0 {
+		return 0, fmt.Errorf("pll %d %w", pll, ErrOutOfRange)
+	}
+	pllAddr := pllParams[pll]
+	enableBits := true
+	if a.Model != nil {
+		pllAddr = a.Model.Reg(pllAddr)
+		enableBits = a.Model.PLLEnableBits
+	}
+	if regVal, exist := a.Regs[pllAddr]; exist {
+		var pllParam PLLParameterReg
+		pllParam.Decode(regVal)
+		if enableBits && (!pllParam.Locked || !pllParam.PLLEn) {
 			return 0, nil
 		}
-		fbdiv := (pllParam >> 16) & 0xfff
-		refdiv := (pllParam >> 8) & 0x3f
-		postdiv1 := (pllParam >> 4) & 0x07
-		postdiv2 := pllParam & 0x07
-		divide := refdiv * postdiv1 * postdiv2
+		divide := uint64(pllParam.RefDiv) * uint64(pllParam.PostDiv1) * uint64(pllParam.PostDiv2)
 		if divide == 0 {
-			return 0, fmt.Errorf("zero divider")
+			return 0, fmt.Errorf("PLL%d zero divider %w", pll, ErrOutOfRange)
 		}
-		return uint32(clki * fbdiv / divide), nil
+		// clki * fbdiv overflows 32 bits from 25MHz * 172
+		return uint32(uint64(clki) * uint64(pllParam.FBDiv) / divide), nil
 	}
-	return 0, fmt.Errorf("PLL%dParameter not found", pll)
+	return 0, fmt.Errorf("PLL%dParameter %w", pll, ErrNotFound)
 }
 
+// Chain is safe for concurrent use once configured, but Asics must then only be
+// read through Chips.
 type Chain struct {
-	port   io.ReadWriter
-	is139x bool
-	clk    uint32
-	Asics  []Asic
+	port      io.ReadWriter
+	is139x    bool
+	clk       uint32
+	wmu       sync.Mutex // one frame at a time on the port
+	rmu       sync.Mutex // one reader of the decoder at a time
+	reqMu     sync.Mutex // one request and its replies at a time
+	mu        sync.RWMutex
+	model     *ChipModel
+	jobFormat JobFormat
+	baud      uint32 // host port speed
+	dec       *Decoder
+	disp      dispatcher
+	// Written with mu and reqMu held, hence readable with either of them
+	Asics []Asic
+	// How long a register read waits for its reply once listening,
+	// and the silence ending a broadcast read. 500ms if 0.
+	CommandTimeout time.Duration
+	// How register and core register reads are retried
+	Retry RetryPolicy
+	// Largest gap, in percent, between a requested baudrate and the achieved
+	// one. DefaultBaudTolerance if 0.
+	BaudTolerance float64
 }
 
 func NewChain(port io.ReadWriter, is139x bool, clk uint32) *Chain {
-	c := &Chain{port: port, is139x: is139x, clk: clk}
+	c := &Chain{port: port, is139x: is139x, clk: clk, baud: ResetBaudrate}
+	c.dec = NewDecoder(port, is139x, MidstateJobFormat.respLen())
+	c.disp.nonces = make(chan NonceReply, nonceQueueLen)
+	if !is139x {
+		c.SetJobFormat(BM1387JobFormat)
+	}
+	return c
+}
+
+// NewChainForModel returns a Chain talking the protocol of model, Init will
+// then refuse chains made of other chips.
+func NewChainForModel(port io.ReadWriter, model *ChipModel, clk uint32) *Chain {
+	c := NewChain(port, model.Preamble, clk)
+	c.model = model
+	c.SetJobFormat(model.JobFormat)
 	return c
 }
 
+// Model returns the chip model of the chain, nil until Init found it.
+func (c *Chain) Model() *ChipModel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.model
+}
+
+// Chips returns a copy of the chips state, which the chain keeps updating.
+func (c *Chain) Chips() []Asic {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	chips := make([]Asic, len(c.Asics))
+	for i, a := range c.Asics {
+		chips[i] = a.clone()
+	}
+	return chips
+}
+
+// clone deep copies the register maps.
+func (a Asic) clone() Asic {
+	clone := Asic{Model: a.Model, Freq: a.Freq}
+	clone.Regs = make(map[RegAddr]uint32, len(a.Regs))
+	for reg, val := range a.Regs {
+		clone.Regs[reg] = val
+	}
+	clone.CoreRegs = make(map[CoreRegID]uint16, len(a.CoreRegs))
+	for id, val := range a.CoreRegs {
+		clone.CoreRegs[id] = val
+	}
+	clone.States = make(map[RegAddr]RegState, len(a.States))
+	for reg, state := range a.States {
+		clone.States[reg] = state
+	}
+	return clone
+}
+
+// setReg records a value read from a chip.
+func (c *Chain) setReg(chipIndex int, regAddr RegAddr, regVal uint32) {
+	c.setRegState(chipIndex, regAddr, regVal, RegKnown)
+}
+
+func (c *Chain) setRegState(chipIndex int, regAddr RegAddr, regVal uint32, state RegState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Asics[chipIndex].setState(regAddr, regVal, state)
+}
+
+func (c *Chain) setCoreReg(chipIndex int, id CoreRegID, val uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Asics[chipIndex].CoreRegs[id] = val
+}
+
+func (c *Chain) registers() []RegAddr {
+	if c.model != nil && c.model.Registers != nil {
+		return c.model.Registers
+	}
+	return allRegisters
+}
+
+// resolveModel checks that every enumerated chip is of the same model, the
+// chain model if already set. Chips of an unknown model are driven without one.
+func (c *Chain) resolveModel(asics []Asic) (*ChipModel, error) {
+	preset := c.Model()
+	chainModel := preset
+	for i := range asics {
+		model, err := LookupChipModel(asics[i].ChipID())
+		if i == 0 && preset == nil {
+			if err != nil {
+				log.Printf("bm13xx: %v, chain driven without a chip model", err)
+			}
+			chainModel = model
+		}
+		if model != chainModel {
+			return nil, fmt.Errorf("chip %d is a %v in a %v chain %w", i, model, chainModel, ErrModel)
+		}
+		asics[i].Model = model
+	}
+	if chainModel != nil && chainModel.Preamble != c.is139x {
+		return nil, fmt.Errorf("%v does not use this preamble setting %w", chainModel, ErrModel)
+	}
+	return chainModel, nil
+}
+
 func (c *Chain) chipIndex(chipAddr byte) (int, error) {
 	for i, a := range c.Asics {
 		if a.Addr() == chipAddr {
 			return i, nil
 		}
 	}
-	return 0, fmt.Errorf("not found")
+	return 0, fmt.Errorf("chip 0x%02X %w", chipAddr, ErrNotFound)
 }
 
+func (c *Chain) enumerate(ctx context.Context, w *waiter) ([]RegisterReply, error) {
+	if err := c.ReadRegister(true, 0, ChipAddress); err != nil {
+		return nil, err
+	}
+	return c.collect(ctx, w)
+}
+
+// Init enumerates the chips, gives them addresses increment apart and sets them
+// up at about 1500000 bauds. It returns the speed the chips UART achieves, the
+// one the host port must run at, which it switches itself on a Transport.
 func (c *Chain) Init(increment byte) (int, error) {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.init(context.Background(), increment)
+}
+
+// InitContext is Init giving up when ctx is done.
+func (c *Chain) InitContext(ctx context.Context, increment byte) (int, error) {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.init(ctx, increment)
+}
+
+func (c *Chain) init(ctx context.Context, increment byte) (int, error) {
 	if increment == 0 {
-		return 0, fmt.Errorf("increment must be greater than 0")
+		return 0, fmt.Errorf("increment 0 %w", ErrOutOfRange)
 	}
 	if len(c.Asics) > 0 {
-		return 0, fmt.Errorf("already enumerated")
+		return 0, fmt.Errorf("already enumerated %w", ErrInvalidState)
 	}
 	// Enumerate the chips
-	c.ReadRegister(true, 0, ChipAddress)
-	for {
-		regVal, chipAddr, regAddr, err := c.GetResponse()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return 0, err
-		}
-		if regAddr != byte(ChipAddress) {
-			return 0, fmt.Errorf("bad regAddr")
-		}
-		if chipAddr != 0x00 {
-			return 0, fmt.Errorf("bad chipAddr")
+	w := c.addWaiter(true, 0, ChipAddress)
+	replies, err := c.enumerate(ctx, w)
+	c.removeWaiter(w)
+	if err != nil {
+		return 0, err
+	}
+	var asics []Asic
+	for _, reply := range replies {
+		if reply.ChipAddr != 0x00 {
+			return 0, &UnexpectedResponseError{WantChipAddr: 0, WantRegAddr: ChipAddress, Got: reply}
 		}
 		a := Asic{}
 		a.Regs = make(map[RegAddr]uint32)
-		a.Regs[ChipAddress] = regVal
+		a.Regs[ChipAddress] = reply.Value
 		a.CoreRegs = make(map[CoreRegID]uint16)
-		c.Asics = append(c.Asics, a)
+		a.States = map[RegAddr]RegState{ChipAddress: RegKnown}
+		asics = append(asics, a)
+	}
+	model, err := c.resolveModel(asics)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.model = model
+	c.Asics = asics
+	c.mu.Unlock()
+	if model != nil {
+		c.SetJobFormat(model.JobFormat)
 	}
 	// ChainInactive 3 times
 	for i := 0; i < 3; i++ {
-		c.Inactive()
+		c.sendCommand(chainInactive, true, 0, 0, nil)
+		if err := sleep(ctx, 30*time.Millisecond); err != nil {
+			return 0, err
+		}
 	}
 	// Gives new ChipAddresses
-	if len(c.Asics)-1*int(increment) > 255 {
-		return 0, fmt.Errorf("too many chips or too big increment")
+	addrSpace := 256
+	if c.model != nil {
+		addrSpace = c.model.AddrSpace
+	}
+	if (len(c.Asics)-1)*int(increment) >= addrSpace {
+		return 0, fmt.Errorf("%d chips %d apart %w", len(c.Asics), increment, ErrOutOfRange)
 	}
 	newChipAddr := byte(0)
 	for i := range c.Asics {
-		err := c.SetChipAddr(newChipAddr)
-		if err != nil {
+		if _, err := c.sendCommand(setChipAddr, false, newChipAddr, 0, nil); err != nil {
 			return 0, err
 		}
-		c.Asics[i].Regs[ChipAddress] += uint32(newChipAddr)
+		if err := sleep(ctx, 30*time.Millisecond); err != nil {
+			return 0, err
+		}
+		c.setReg(i, ChipAddress, c.Asics[i].Regs[ChipAddress]+uint32(newChipAddr))
 		newChipAddr += increment
 	}
+	if c.model == BM1387 {
+		return c.initBM1387(ctx)
+	}
 	// Init gekko style
-	c.WriteRegister(true, 0, ClockOrderControl0, 0)
-	time.Sleep(10 * time.Millisecond)
-	c.WriteRegister(true, 0, ClockOrderControl1, 0)
-	time.Sleep(100 * time.Millisecond)
-	c.WriteRegister(true, 0, OrderedClockEnable, 1)
-	time.Sleep(50 * time.Millisecond)
-	c.WriteRegister(true, 0, CoreRegisterControl, 0x80008074)
-	time.Sleep(10 * time.Millisecond)
-	c.WriteRegister(true, 0, TicketMask, 0xF0)
-	time.Sleep(100 * time.Millisecond)
-	c.WriteRegister(true, 0, MiscControl, 0x6131)
-	return 1500000, nil
+	steps := []struct {
+		regAddr RegAddr
+		regVal  uint32
+		wait    time.Duration
+	}{
+		{ClockOrderControl0, 0, 10 * time.Millisecond},
+		{ClockOrderControl1, 0, 100 * time.Millisecond},
+		{OrderedClockEnable, 1, 50 * time.Millisecond},
+		{CoreRegisterControl, 0x80008074, 10 * time.Millisecond},
+		{TicketMask, 0xF0, 100 * time.Millisecond},
+		{MiscControl, 0x7A31, 0},
+	}
+	for _, step := range steps {
+		c.writeRegister(true, 0, step.regAddr, step.regVal)
+		if err := sleep(ctx, step.wait); err != nil {
+			return 0, err
+		}
+	}
+	baud := uint32(initBaudrate)
+	if c.model != nil && c.model.MaxBaud < baud {
+		baud = c.model.MaxBaud
+	}
+	baud, err = c.switchBaudrate(ctx, baud)
+	return int(baud), err
 
 	// Init T17 style
 	// time.Sleep(120 * time.Millisecond)
@@ -161,165 +352,274 @@ func (c *Chain) Init(increment byte) (int, error) {
 	// return 3000000, nil
 }
 
+func (c *Chain) initBM1387(ctx context.Context) (int, error) {
+	// Init compac style, INV_CLKO | BT8D = 26 keeps 115200 bauds
+	if err := c.writeRegister(true, 0, BM1387MiscControl, 0x40201A00); err != nil {
+		return 0, err
+	}
+	return int(c.Baudrate()), sleep(ctx, 50*time.Millisecond)
+}
+
+// ReadRegisterContext reads a register of one chip and waits for its reply,
+// until the command timeout or ctx is done.
+func (c *Chain) ReadRegisterContext(ctx context.Context, chipAddr byte, regAddr RegAddr) (uint32, error) {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.readRegister(ctx, chipAddr, regAddr)
+}
+
 func (c *Chain) ReadAllRegisters(chipIndex int) error {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.readAllRegisters(context.Background(), chipIndex)
+}
+
+func (c *Chain) ReadAllRegistersContext(ctx context.Context, chipIndex int) error {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.readAllRegisters(ctx, chipIndex)
+}
+
+func (c *Chain) readAllRegisters(ctx context.Context, chipIndex int) error {
 	if chipIndex >= len(c.Asics) {
-		return fmt.Errorf("chipIndex %d out of range", chipIndex)
+		return fmt.Errorf("chipIndex %d %w", chipIndex, ErrOutOfRange)
 	}
-	regs := allRegisters
+	regs := c.registers()
 	for _, reg := range regs {
-		c.ReadRegister(false, c.Asics[chipIndex].Addr(), reg)
-		regVal, chipAddr, regAddr, err := c.GetResponse()
+		regVal, err := c.readRegister(ctx, c.Asics[chipIndex].Addr(), reg)
 		if err != nil {
-			fmt.Printf("GetResponse error: %v\n", err)
 			return err
 		}
-		if regAddr != byte(reg) {
-			return fmt.Errorf("bad regAddr")
-		}
-		if chipAddr != 0x00 {
-			return fmt.Errorf("bad chipAddr")
-		}
-		c.Asics[chipIndex].Regs[reg] = regVal
+		c.setReg(chipIndex, reg, regVal)
 	}
 	return nil
 }
 
+// ReadUnknownRegisters reads the undocumented registers of a chip, the ones
+// failing are skipped and the first error returned.
 func (c *Chain) ReadUnknownRegisters(chipIndex int) error {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
 	if chipIndex >= len(c.Asics) {
-		return fmt.Errorf("chipIndex %d out of range", chipIndex)
+		return fmt.Errorf("chipIndex %d %w", chipIndex, ErrOutOfRange)
 	}
+	var firstErr error
 	regs := []RegAddr{0x24, 0x30, 0x34, 0x88}
 	for _, reg := range regs {
-		c.ReadRegister(false, c.Asics[chipIndex].Addr(), reg)
-		regVal, chipAddr, regAddr, err := c.GetResponse()
+		regVal, err := c.readRegister(context.Background(), c.Asics[chipIndex].Addr(), reg)
 		if err != nil {
-			fmt.Printf("GetResponse error: %v\n", err)
-			continue
-		}
-		if regAddr != byte(reg) {
-			fmt.Printf("bad regAddr: %v\n", regAddr)
-			continue
-		}
-		if chipAddr != 0x00 {
-			fmt.Printf("bad chipAddr: %v\n", chipAddr)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("register 0x%02X: %w", byte(reg), err)
+			}
 			continue
 		}
-		c.Asics[chipIndex].Regs[reg] = regVal
+		c.setReg(chipIndex, reg, regVal)
 	}
-	return nil
+	return firstErr
 }
 
 func (c *Chain) ReadCoreRegister(chipAddr byte, coreID uint16, coreRegID CoreRegID) (uint16, error) {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.readCoreRegister(context.Background(), chipAddr, coreID, coreRegID)
+}
+
+func (c *Chain) ReadCoreRegisterContext(ctx context.Context, chipAddr byte, coreID uint16, coreRegID CoreRegID) (uint16, error) {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.readCoreRegister(ctx, chipAddr, coreID, coreRegID)
+}
+
+// checkCore makes sure a core of a chip has registers to access.
+func (c *Chain) checkCore(chipAddr byte, coreID uint16) error {
 	chipIndex, err := c.chipIndex(chipAddr)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if c.model != nil && !c.model.CoreRegs {
+		return fmt.Errorf("core registers of %v %w", c.model, ErrNotFound)
 	}
 	if coreID >= uint16(c.Asics[chipIndex].CoreNum()) {
-		return 0, fmt.Errorf("coreID %d out of range", coreID)
+		return fmt.Errorf("coreID %d %w", coreID, ErrOutOfRange)
 	}
-	// coreRegCtrlVal := uint32(0x7e003000)
-	coreRegCtrlVal := uint32(0x000000ff)
-	coreRegCtrlVal |= uint32(coreRegID) << 8
-	coreRegCtrlVal |= uint32(coreID) << 16
-	err = c.WriteRegister(false, chipAddr, CoreRegisterControl, coreRegCtrlVal)
-	if err != nil {
+	return nil
+}
+
+func (c *Chain) readCoreRegister(ctx context.Context, chipAddr byte, coreID uint16, coreRegID CoreRegID) (uint16, error) {
+	if err := c.checkCore(chipAddr, coreID); err != nil {
 		return 0, err
 	}
-	coreRegVal, chip, reg, err := c.GetResponse()
+	// coreRegCtrlVal := uint32(0x7e003000)
+	coreRegCtrl := CoreRegisterControlReg{CoreID: byte(coreID), CoreRegID: coreRegID, Value: 0xff}
+	coreRegCtrlVal := coreRegCtrl.Encode()
+	var reply RegisterReply
+	err := c.retry(ctx, func() error {
+		w := c.addWaiter(false, chipAddr, CoreRegisterValue)
+		defer c.removeWaiter(w)
+		if err := c.writeRegister(false, chipAddr, CoreRegisterControl, coreRegCtrlVal); err != nil {
+			return err
+		}
+		var err error
+		reply, err = c.await(ctx, w)
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
-	if chipAddr != chip {
-		return 0, fmt.Errorf("bad chipAddr")
-	}
-	if byte(CoreRegisterValue) != reg {
-		return 0, fmt.Errorf("bad regAddr")
-	}
+	coreRegVal := reply.Value
 	if uint16(coreRegVal>>16) != coreID {
-		return 0, fmt.Errorf("bad coreID")
+		// another core answered
+		return 0, &UnexpectedResponseError{WantChipAddr: chipAddr, WantRegAddr: CoreRegisterValue, Got: reply}
 	}
 	return uint16(coreRegVal & 0xffff), nil
 }
 
+// WriteCoreRegister sets a core register of one core through CoreRegisterControl,
+// only the 8 lowest bits of value can be written. The chip core registers then
+// hold value, as after ReadAllCoreRegisters.
+func (c *Chain) WriteCoreRegister(chipAddr byte, coreID uint16, id CoreRegID, value uint16) error {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	if err := c.checkCore(chipAddr, coreID); err != nil {
+		return err
+	}
+	if value > 0xff {
+		return fmt.Errorf("core register value 0x%04X %w", value, ErrOutOfRange)
+	}
+	coreRegCtrl := CoreRegisterControlReg{WriteMSB: true, Write: true, CoreID: byte(coreID), CoreRegID: id, Value: byte(value)}
+	if err := c.writeRegister(false, chipAddr, CoreRegisterControl, coreRegCtrl.Encode()); err != nil {
+		return err
+	}
+	chipIndex, err := c.chipIndex(chipAddr)
+	if err != nil {
+		return err
+	}
+	c.setCoreReg(chipIndex, id, value)
+	return nil
+}
+
+// ReadAllCoreRegisters reads the core registers of a core, the ones failing are
+// skipped and the first error returned.
 func (c *Chain) ReadAllCoreRegisters(chipAddr byte, coreID uint16) error {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
 	chipIndex, err := c.chipIndex(chipAddr)
 	if err != nil {
 		return err
 	}
 	if coreID >= uint16(c.Asics[chipIndex].CoreNum()) {
-		return fmt.Errorf("coreID %d out of range", coreID)
+		return fmt.Errorf("coreID %d %w", coreID, ErrOutOfRange)
 	}
+	var firstErr error
 	regs := allCoreRegisters
 	for _, reg := range regs {
-		val, err := c.ReadCoreRegister(chipAddr, coreID, reg)
+		val, err := c.readCoreRegister(context.Background(), chipAddr, coreID, reg)
 		if err != nil {
-			fmt.Printf("ReadCoreRegister on reg %v error: %v\n", reg, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("core register %v: %w", reg, err)
+			}
 			continue
 		}
-		c.Asics[chipIndex].CoreRegs[reg] = val
+		c.setCoreReg(chipIndex, reg, val)
 	}
-	return nil
+	return firstErr
+}
+
+// SetBaudrate sets the chips UART to the baudrate the closest to baud, and
+// returns the speed of the host port, which it switches on a Transport.
+func (c *Chain) SetBaudrate(baud uint32) (uint32, error) {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.switchBaudrate(context.Background(), baud)
+}
+
+func (c *Chain) SetBaudrateContext(ctx context.Context, baud uint32) (uint32, error) {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.switchBaudrate(ctx, baud)
 }
 
-func (c *Chain) SetBaudrate(baud uint32) error {
-	if baud < 115200 || baud > 7000000 {
-		return fmt.Errorf("bad baudrate, accepted range [115200:7000000]")
-	}
-	if len(c.Asics) == 0 {
-		return fmt.Errorf("no asic found")
-	}
-	baseClk := c.clk
-	if baud > 3000000 {
-		// LOCKED | PLLEN | FBDIV = 112 | REFDIV = 1 | POSTDIV1 = 1 | POSTDIV2 = 1
-		// PLL3 = 25MHz * 112 = 2.8GHz
-		c.WriteRegister(true, 0, PLL3Parameter, 0xc0700111)
-		c.WriteRegister(true, 0, PLL3Parameter, 0xc0700111)
-		// PLL3_DIV4 = 6 | CLKO_DIV = 15
-		// uart baseClk is PLL3 / (DIV4 + 1) = 2.8GHz / (6 + 1) = 400MHz
-		c.WriteRegister(true, 0, FastUARTConfiguration, 0x600000f)
-		baseClk = 400000000
-	}
-	// TODO : calculate divider based on baseClk and baud
-	divider := uint32(baseClk / baud)
-	bt8d_4_0 := divider & 0x1f
-	bt8d_8_5 := (divider >> 5) & 0x0f
-	miscCtrl, exist := c.Asics[0].Regs[MiscControl]
-	if !exist {
-		// Use first asic in chain to read MiscControl register value
-		c.ReadRegister(false, 0, MiscControl)
-		val, _, reg, err := c.GetResponse()
+func (c *Chain) setBaudrate(ctx context.Context, baud uint32) (uint32, error) {
+	plan, err := c.model.PlanBaudrate(c.clk, baud, c.BaudTolerance)
+	if err != nil {
+		return 0, err
+	}
+	if c.model == BM1387 {
+		return plan.Baud, c.setBaudrateBM1387(ctx, plan)
+	}
+	if plan.BClkSel {
+		// written twice, as the reference init does
+		c.writeRegister(true, 0, PLL3Parameter, plan.PLL3.Encode())
+		if err := c.writeRegister(true, 0, PLL3Parameter, plan.PLL3.Encode()); err != nil {
+			return 0, err
+		}
+		regVal, err := c.firstChipReg(ctx, FastUARTConfiguration)
 		if err != nil {
-			return err
+			return 0, err
 		}
-		c.Asics[0].Regs[RegAddr(reg)] = val
-		if reg == byte(MiscControl) {
-			miscCtrl = val
-		} else {
-			return fmt.Errorf("unexpected register")
+		var fastUART FastUARTConfigReg
+		fastUART.Decode(regVal)
+		fastUART.PLL3Div4 = plan.PLL3Div4
+		if err := c.writeRegister(true, 0, FastUARTConfiguration, fastUART.Encode()); err != nil {
+			return 0, err
 		}
 	}
-	miscCtrl = miscCtrl&0xf0fee0ff | bt8d_4_0<<8 | bt8d_8_5<<24
-	if baud > 3000000 {
-		miscCtrl |= 1 << 16 // BCLK_SEL = 1
+	regVal, err := c.firstChipReg(ctx, MiscControl)
+	if err != nil {
+		return 0, err
 	}
+	var miscCtrl MiscControlReg
+	miscCtrl.Decode(regVal)
+	miscCtrl.BT8D = plan.BT8D
+	miscCtrl.BClkSel = plan.BClkSel
 	// Apply the new baudrate settings to all Asics in chain
-	c.WriteRegister(true, 0, MiscControl, miscCtrl)
-	return nil
+	if err := c.writeRegister(true, 0, MiscControl, miscCtrl.Encode()); err != nil {
+		return 0, err
+	}
+	return plan.Baud, nil
 }
 
-func (c *Chain) DumpChipRegiters(chipIndex int, debug bool) error {
-	if chipIndex >= len(c.Asics) || chipIndex < 0 {
-		return fmt.Errorf("bad chipIndex")
+func (c *Chain) setBaudrateBM1387(ctx context.Context, plan BaudPlan) error {
+	regVal, err := c.firstChipReg(ctx, BM1387MiscControl)
+	if err != nil {
+		return err
 	}
-	for _, addr := range allRegisters {
-		if val, exist := c.Asics[chipIndex].Regs[addr]; exist {
-			DumpAsicReg(addr, val, debug)
-		}
+	var miscCtrl BM1387MiscControlReg
+	miscCtrl.Decode(regVal)
+	miscCtrl.BT8D = byte(plan.BT8D)
+	return c.writeRegister(true, 0, BM1387MiscControl, miscCtrl.Encode())
+}
+
+// firstChipReg returns a register of the first chip, read from it if not known,
+// the chips of a chain being set alike.
+func (c *Chain) firstChipReg(ctx context.Context, regAddr RegAddr) (uint32, error) {
+	if regVal, exist := c.Asics[0].Regs[regAddr]; exist {
+		return regVal, nil
 	}
-	for _, id := range allCoreRegisters {
-		if val, exist := c.Asics[chipIndex].CoreRegs[id]; exist {
-			DumpCoreReg(id, val, debug)
-		}
+	regVal, err := c.readRegister(ctx, c.Asics[0].Addr(), regAddr)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	c.setReg(0, regAddr, regVal)
+	return regVal, nil
+}
+
+func (c *Chain) DumpChipRegiters(chipIndex int, debug bool) error {
+	return c.FormatChipRegisters(os.Stdout, chipIndex, TextFormatter{Debug: debug})
+}
+
+// FormatChipRegisters renders the registers read so far of a chip to w.
+func (c *Chain) FormatChipRegisters(w io.Writer, chipIndex int, f Formatter) error {
+	c.mu.RLock()
+	if chipIndex >= len(c.Asics) || chipIndex < 0 {
+		c.mu.RUnlock()
+		return fmt.Errorf("chipIndex %d %w", chipIndex, ErrOutOfRange)
+	}
+	chip := c.Asics[chipIndex].clone()
+	c.mu.RUnlock()
+	return f.Format(w, chip)
 }
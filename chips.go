@@ -0,0 +1,179 @@
+package bm13xx
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ChipModel describes what differs between the chips of the family.
+type ChipModel struct {
+	Name          string
+	ChipID        uint16 // as read in ChipAddress BIT[31:16]
+	Cores         int
+	SmallCores    int // total of small cores, equals Cores if not split
+	AddrSpace     int // number of chip addresses available on a chain
+	MinBaud       uint32
+	MaxBaud       uint32
+	Preamble      bool // 0x55 0xAA before commands, 0xAA 0x55 before responses
+	JobFormat     JobFormat
+	MaxMidstates  int
+	Registers     []RegAddr           // registers answering a ReadRegister
+	RegMap        map[RegAddr]RegAddr // BM1397 register address -> same register on this model
+	CoreRegs      bool                // cores registers accessible through CoreRegisterControl
+	PLLEnableBits bool                // PLL parameters have LOCKED and PLLEN bits
+	Schema        *Schema             // registers layout, DefaultSchema if nil
+	PLL           PLLLimits           // PLL0 dividers range, DefaultPLLLimits if zero
+}
+
+// Reg returns the address of a BM1397 named register on this model, the same
+// on a nil (unknown) model.
+func (m *ChipModel) Reg(r RegAddr) RegAddr {
+	if m == nil {
+		return r
+	}
+	if addr, exist := m.RegMap[r]; exist {
+		return addr
+	}
+	return r
+}
+
+var bm1366Registers = append(append([]RegAddr{}, allRegisters...), VersionRolling)
+
+var (
+	BM1387 = &ChipModel{
+		Name:         "BM1387",
+		ChipID:       0x1387,
+		Cores:        114,
+		SmallCores:   114,
+		AddrSpace:    256,
+		MinBaud:      115200,
+		MaxBaud:      3125000,
+		Preamble:     false,
+		JobFormat:    BM1387JobFormat,
+		MaxMidstates: 1,
+		Registers:    allBM1387Registers,
+		PLL:          PLLLimits{MinVCO: 400, MaxVCO: 1600, MaxFBDiv: 0xff, MaxRefDiv: 0x0f},
+		RegMap: map[RegAddr]RegAddr{
+			PLL0Parameter:      BM1387PLLParameter,
+			ChipNonceOffset:    BM1387StartNonceOffset,
+			HashCountingNumber: BM1387HashCountingNumber,
+			TicketMask:         BM1387TicketMask,
+			MiscControl:        BM1387MiscControl,
+			I2CControl:         BM1387I2CCommand,
+		},
+	}
+	BM1397 = &ChipModel{
+		Name:          "BM1397",
+		ChipID:        0x1397,
+		Cores:         168,
+		SmallCores:    672,
+		AddrSpace:     256,
+		MinBaud:       115200,
+		MaxBaud:       7000000,
+		Preamble:      true,
+		JobFormat:     MidstateJobFormat,
+		MaxMidstates:  4,
+		Registers:     allRegisters,
+		CoreRegs:      true,
+		PLLEnableBits: true,
+	}
+	BM1398 = &ChipModel{
+		Name:          "BM1398",
+		ChipID:        0x1398,
+		Cores:         168,
+		SmallCores:    672,
+		AddrSpace:     256,
+		MinBaud:       115200,
+		MaxBaud:       7000000,
+		Preamble:      true,
+		JobFormat:     MidstateJobFormat,
+		MaxMidstates:  4,
+		Registers:     allRegisters,
+		CoreRegs:      true,
+		PLLEnableBits: true,
+	}
+	BM1366 = &ChipModel{
+		Name:          "BM1366",
+		ChipID:        0x1366,
+		Cores:         112,
+		SmallCores:    894,
+		AddrSpace:     256,
+		MinBaud:       115200,
+		MaxBaud:       1000000,
+		Preamble:      true,
+		JobFormat:     FullHeaderJobFormat,
+		MaxMidstates:  1,
+		Registers:     bm1366Registers,
+		CoreRegs:      true,
+		PLLEnableBits: true,
+	}
+	BM1368 = &ChipModel{
+		Name:          "BM1368",
+		ChipID:        0x1368,
+		Cores:         80,
+		SmallCores:    1276,
+		AddrSpace:     256,
+		MinBaud:       115200,
+		MaxBaud:       1000000,
+		Preamble:      true,
+		JobFormat:     FullHeaderJobFormat,
+		MaxMidstates:  1,
+		Registers:     bm1366Registers,
+		CoreRegs:      true,
+		PLLEnableBits: true,
+	}
+	BM1370 = &ChipModel{
+		Name:          "BM1370",
+		ChipID:        0x1370,
+		Cores:         128,
+		SmallCores:    2040,
+		AddrSpace:     256,
+		MinBaud:       115200,
+		MaxBaud:       1000000,
+		Preamble:      true,
+		JobFormat:     FullHeaderJobFormat,
+		MaxMidstates:  1,
+		Registers:     bm1366Registers,
+		CoreRegs:      true,
+		PLLEnableBits: true,
+	}
+)
+
+var (
+	chipModelsMu sync.RWMutex
+	chipModels   = []*ChipModel{BM1387, BM1397, BM1398, BM1366, BM1368, BM1370}
+)
+
+// RegisterChipModel makes a new chip model known to Chain.Init.
+func RegisterChipModel(m *ChipModel) error {
+	chipModelsMu.Lock()
+	defer chipModelsMu.Unlock()
+	if lookupChipModel(m.ChipID) != nil {
+		return fmt.Errorf("CHIP_ID 0x%04X already registered %w", m.ChipID, ErrModel)
+	}
+	chipModels = append(chipModels, m)
+	return nil
+}
+
+// LookupChipModel returns the model of a CHIP_ID.
+func LookupChipModel(chipID uint16) (*ChipModel, error) {
+	chipModelsMu.RLock()
+	defer chipModelsMu.RUnlock()
+	if m := lookupChipModel(chipID); m != nil {
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown CHIP_ID 0x%04X %w", chipID, ErrModel)
+}
+
+func lookupChipModel(chipID uint16) *ChipModel {
+	for _, m := range chipModels {
+		if m.ChipID == chipID {
+			return m
+		}
+	}
+	return nil
+}
+
+func (m *ChipModel) String() string {
+	return m.Name
+}
@@ -0,0 +1,48 @@
+package bm13xx
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupChipModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		asic    Asic
+		want    *ChipModel
+		wantErr bool
+	}{
+		{
+			name: "BM1397 Chip0",
+			asic: Asic{Regs: map[RegAddr]uint32{ChipAddress: 0x13971800}},
+			want: BM1397,
+		},
+		{
+			name: "BM1366 Chip8",
+			asic: Asic{Regs: map[RegAddr]uint32{ChipAddress: 0x13660008}},
+			want: BM1366,
+		},
+		{
+			name:    "unknown",
+			asic:    Asic{Regs: map[RegAddr]uint32{ChipAddress: 0x12340000}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LookupChipModel(tt.asic.ChipID())
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrModel)) {
+				t.Errorf("LookupChipModel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LookupChipModel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterChipModel(t *testing.T) {
+	if err := RegisterChipModel(&ChipModel{Name: "BM1397", ChipID: 0x1397}); !errors.Is(err, ErrModel) {
+		t.Errorf("RegisterChipModel() error = %v, want ErrModel", err)
+	}
+}
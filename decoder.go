@@ -0,0 +1,144 @@
+package bm13xx
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+)
+
+var preamble = []byte{0xAA, 0x55}
+
+// DecoderStats counts what a Decoder has seen on the line.
+type DecoderStats struct {
+	Frames    uint64 // valid frames returned
+	CRCErrors uint64 // frames dropped because of a bad crc5
+	Discarded uint64 // bytes dropped while hunting for the next frame
+}
+
+// Decoder extracts response frames from a byte stream which the transport
+// may split arbitrarily and which may contain garbage between frames.
+type Decoder struct {
+	r        io.Reader
+	preamble bool
+	frameLen int32 // atomic, changed by SetFrameLen while Next may run
+	buf      []byte
+	synced   bool
+	stats    DecoderStats
+}
+
+// NewDecoder returns a Decoder for frames of frameLen bytes (preamble excluded).
+func NewDecoder(r io.Reader, preamble bool, frameLen int) *Decoder {
+	return &Decoder{r: r, preamble: preamble, frameLen: int32(frameLen), synced: true}
+}
+
+// SetFrameLen changes the length of the frames to come, it may be called while
+// another goroutine waits in Next.
+func (d *Decoder) SetFrameLen(frameLen int) {
+	atomic.StoreInt32(&d.frameLen, int32(frameLen))
+}
+
+// Next returns the next valid frame without its preamble.
+// A bad crc5 error only concerns the dropped frame, and a bad preamble error the
+// bytes dropped to resynchronise, the stream can be read further.
+func (d *Decoder) Next() ([]byte, error) {
+	for {
+		frame, found, err := d.extract()
+		if found || err != nil {
+			return frame, err
+		}
+		if err := d.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Stats returns the counters accumulated since the Decoder creation.
+func (d *Decoder) Stats() DecoderStats {
+	return d.stats
+}
+
+// Reset drops every buffered byte, like after a line speed change.
+func (d *Decoder) Reset() {
+	d.stats.Discarded += uint64(len(d.buf))
+	d.buf = d.buf[:0]
+	d.synced = true
+}
+
+func (d *Decoder) discard(n int) {
+	d.stats.Discarded += uint64(n)
+	d.buf = d.buf[n:]
+}
+
+func (d *Decoder) extract() ([]byte, bool, error) {
+	if d.preamble {
+		return d.extractPreamble()
+	}
+	frameLen := int(atomic.LoadInt32(&d.frameLen))
+	for len(d.buf) >= frameLen {
+		if crc5(d.buf[:frameLen]) == 0x00 {
+			frame := make([]byte, frameLen)
+			copy(frame, d.buf)
+			d.buf = d.buf[frameLen:]
+			d.synced = true
+			d.stats.Frames++
+			return frame, true, nil
+		}
+		// Without preamble the only way to resync is to slide byte by byte
+		d.discard(1)
+		if d.synced {
+			d.synced = false
+			d.stats.CRCErrors++
+			return nil, false, ErrCRC
+		}
+	}
+	return nil, false, nil
+}
+
+func (d *Decoder) extractPreamble() ([]byte, bool, error) {
+	i := bytes.Index(d.buf, preamble)
+	if i < 0 {
+		// keep a trailing half preamble
+		i = len(d.buf)
+		if i > 0 && d.buf[i-1] == preamble[0] {
+			i--
+		}
+	}
+	if i > 0 {
+		d.discard(i)
+		// reported once per resynchronisation
+		if d.synced {
+			d.synced = false
+			return nil, false, ErrPreamble
+		}
+	}
+	frameLen := int(atomic.LoadInt32(&d.frameLen))
+	if len(d.buf) < len(preamble)+frameLen {
+		return nil, false, nil
+	}
+	frame := d.buf[len(preamble) : len(preamble)+frameLen]
+	if crc5(frame) != 0x00 {
+		// drop only the preamble, a real frame may start inside this one
+		d.buf = d.buf[len(preamble):]
+		d.synced = false
+		d.stats.CRCErrors++
+		return nil, false, ErrCRC
+	}
+	frame = append([]byte(nil), frame...)
+	d.buf = d.buf[len(preamble)+frameLen:]
+	d.synced = true
+	d.stats.Frames++
+	return frame, true, nil
+}
+
+func (d *Decoder) fill() error {
+	var tmp [64]byte
+	n, err := d.r.Read(tmp[:])
+	if n > 0 {
+		d.buf = append(d.buf, tmp[:n]...)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrShortFrame
+}
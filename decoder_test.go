@@ -0,0 +1,96 @@
+package bm13xx
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecoder_Next(t *testing.T) {
+	miscCtrl := []byte{0x00, 0x00, 0x61, 0x31, 0x00, 0x18, 0x04}
+	nonce := []byte{0x7C, 0x2B, 0xAC, 0x1D, 0x00, 0x32, 0x97}
+	badNonce := []byte{0x7C, 0x2B, 0xAC, 0x1D, 0x00, 0x32, 0x17}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	tests := []struct {
+		name       string
+		preamble   bool
+		stream     []byte
+		oneByte    bool
+		wantFrames [][]byte
+		wantErrs   int
+		wantStats  DecoderStats
+	}{
+		{
+			name:       "frames split byte by byte",
+			preamble:   true,
+			stream:     join(preamble, miscCtrl, preamble, nonce),
+			oneByte:    true,
+			wantFrames: [][]byte{miscCtrl, nonce},
+			wantStats:  DecoderStats{Frames: 2},
+		},
+		{
+			name:       "garbage before preamble",
+			preamble:   true,
+			stream:     join([]byte{0x00, 0xAA, 0x13}, preamble, miscCtrl),
+			wantFrames: [][]byte{miscCtrl},
+			wantErrs:   1,
+			wantStats:  DecoderStats{Frames: 1, Discarded: 3},
+		},
+		{
+			name:       "bad crc5 then resync",
+			preamble:   true,
+			stream:     join(preamble, badNonce, preamble, nonce),
+			wantFrames: [][]byte{nonce},
+			wantErrs:   1,
+			wantStats:  DecoderStats{Frames: 1, CRCErrors: 1, Discarded: 7},
+		},
+		{
+			name:       "no preamble resync",
+			preamble:   false,
+			stream:     join([]byte{0x12, 0x34}, miscCtrl, nonce),
+			wantFrames: [][]byte{miscCtrl, nonce},
+			wantErrs:   1,
+			wantStats:  DecoderStats{Frames: 2, CRCErrors: 1, Discarded: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r io.Reader = bytes.NewReader(tt.stream)
+			if tt.oneByte {
+				r = iotest.OneByteReader(r)
+			}
+			d := NewDecoder(r, tt.preamble, 7)
+			var frames [][]byte
+			errs := 0
+			for {
+				frame, err := d.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					if !errors.Is(err, ErrCRC) && !errors.Is(err, ErrPreamble) {
+						t.Errorf("Decoder.Next() error = %v, want %v or %v", err, ErrCRC, ErrPreamble)
+					}
+					errs++
+					continue
+				}
+				frames = append(frames, frame)
+			}
+			if !cmp.Equal(frames, tt.wantFrames) {
+				t.Errorf("Decoder.Next() frames = %X, want %X", frames, tt.wantFrames)
+			}
+			if errs != tt.wantErrs {
+				t.Errorf("Decoder.Next() errors = %d, want %d", errs, tt.wantErrs)
+			}
+			if got := d.Stats(); got != tt.wantStats {
+				t.Errorf("Decoder.Stats() = %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package bm13xx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	nonceQueueLen   = 256
+	responseTimeout = 500 * time.Millisecond
+	// time to wait when the transport had nothing to read
+	idleDelay = time.Millisecond
+)
+
+// Stats gathers the counters of the chain communication.
+type Stats struct {
+	Decoder       DecoderStats
+	Unsolicited   uint64 // register replies nobody was waiting for
+	DroppedNonces uint64 // nonces lost because the Nonces channel was full
+	Retries       uint64 // register reads attempted again, see RetryPolicy
+}
+
+// waiter is a pending register read, a waiter for all chips matches any chip address.
+type waiter struct {
+	all      bool
+	chipAddr byte
+	regAddr  RegAddr
+	replies  chan RegisterReply
+}
+
+type dispatcher struct {
+	mu            sync.Mutex
+	waiters       []*waiter
+	listening     bool
+	explicit      bool // started by Listen, not only for the calls in progress
+	calls         int  // calls relying on the listener, see ensureListening
+	stop          chan struct{}
+	done          chan struct{}
+	failed        chan struct{} // closed when the listener stops on a port error
+	err           error         // why the listener stopped
+	nonces        chan NonceReply
+	unsolicited   uint64
+	droppedNonces uint64
+	retries       uint64
+	decStats      DecoderStats
+}
+
+// Listen starts a goroutine reading every frame from the chain, routing register
+// replies to the pending reads and nonces to the Nonces channel.
+// GetResponse, ReadResponse and ReadNonce must not be used while listening.
+// It stops on a port error other than a bad frame or a read timeout, failing the
+// pending reads. Without Listen, the context variants listen only while they run.
+func (c *Chain) Listen() error {
+	c.disp.mu.Lock()
+	defer c.disp.mu.Unlock()
+	if c.disp.explicit {
+		return fmt.Errorf("already listening %w", ErrInvalidState)
+	}
+	if !c.disp.listening {
+		c.startListener()
+	}
+	c.disp.explicit = true
+	return nil
+}
+
+// ensureListening starts the reader goroutine unless it already runs, so that the
+// context variants never block on the transport. The returned func stops it once
+// the last call relying on it is over, unless Listen was called.
+func (c *Chain) ensureListening() func() {
+	c.disp.mu.Lock()
+	defer c.disp.mu.Unlock()
+	if !c.disp.listening {
+		c.startListener()
+	}
+	c.disp.calls++
+	return func() {
+		c.disp.mu.Lock()
+		c.disp.calls--
+		if c.disp.calls > 0 || c.disp.explicit || !c.disp.listening {
+			c.disp.mu.Unlock()
+			return
+		}
+		done := c.stopListener()
+		c.disp.mu.Unlock()
+		<-done
+	}
+}
+
+// startListener must be called with the dispatcher locked.
+func (c *Chain) startListener() {
+	c.disp.listening = true
+	c.disp.stop = make(chan struct{})
+	c.disp.done = make(chan struct{})
+	c.disp.failed = make(chan struct{})
+	c.disp.err = nil
+	go c.listen(c.disp.stop, c.disp.done)
+}
+
+// StopListening stops the reader goroutine started by Listen, it returns once the
+// pending transport Read is over.
+func (c *Chain) StopListening() {
+	c.disp.mu.Lock()
+	if !c.disp.listening {
+		c.disp.explicit = false
+		c.disp.mu.Unlock()
+		return
+	}
+	done := c.stopListener()
+	c.disp.mu.Unlock()
+	<-done
+}
+
+// stopListener must be called with the dispatcher locked, the listener is over
+// once the returned channel is closed.
+func (c *Chain) stopListener() <-chan struct{} {
+	c.disp.listening = false
+	c.disp.explicit = false
+	close(c.disp.stop)
+	return c.disp.done
+}
+
+// Nonces returns the channel receiving every nonce sent back by the chain.
+func (c *Chain) Nonces() <-chan NonceReply {
+	return c.disp.nonces
+}
+
+// Stats returns the communication counters of the chain.
+func (c *Chain) Stats() Stats {
+	c.disp.mu.Lock()
+	defer c.disp.mu.Unlock()
+	return Stats{
+		Decoder:       c.disp.decStats,
+		Unsolicited:   c.disp.unsolicited,
+		DroppedNonces: c.disp.droppedNonces,
+		Retries:       c.disp.retries,
+	}
+}
+
+func (c *Chain) isListening() bool {
+	c.disp.mu.Lock()
+	defer c.disp.mu.Unlock()
+	return c.disp.listening
+}
+
+// listenState returns whether the listener runs and the channel closed if it fails.
+func (c *Chain) listenState() (bool, <-chan struct{}) {
+	c.disp.mu.Lock()
+	defer c.disp.mu.Unlock()
+	return c.disp.listening, c.disp.failed
+}
+
+// listenErr returns the error which stopped the listener.
+func (c *Chain) listenErr() error {
+	c.disp.mu.Lock()
+	defer c.disp.mu.Unlock()
+	return fmt.Errorf("listener stopped: %w", c.disp.err)
+}
+
+func (c *Chain) listen(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		resp, err := c.readResponse()
+		if err != nil && !transient(err) {
+			// like a closed port, reading again would only spin
+			c.disp.mu.Lock()
+			c.disp.listening = false
+			c.disp.explicit = false
+			c.disp.err = err
+			close(c.disp.failed)
+			c.disp.mu.Unlock()
+			return
+		}
+		if err != nil {
+			// bad frames are accounted by the decoder, keep reading
+			time.Sleep(idleDelay)
+			continue
+		}
+		c.dispatch(resp)
+	}
+}
+
+// transient tells if a read error only concerns a frame or an idle line.
+func transient(err error) bool {
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	return isLineGlitch(err) || errors.Is(err, ErrPreamble) || errors.Is(err, io.EOF)
+}
+
+// dispatch routes a response, it returns false for a register reply nobody waits for.
+func (c *Chain) dispatch(resp Response) bool {
+	c.disp.mu.Lock()
+	defer c.disp.mu.Unlock()
+	if resp.Nonce != nil {
+		select {
+		case c.disp.nonces <- *resp.Nonce:
+		default:
+			c.disp.droppedNonces++
+		}
+		return true
+	}
+	reply := *resp.Register
+	for i, w := range c.disp.waiters {
+		if w.regAddr != reply.RegAddr || (!w.all && w.chipAddr != reply.ChipAddr) {
+			continue
+		}
+		select {
+		case w.replies <- reply:
+		default:
+			continue
+		}
+		if !w.all {
+			c.disp.waiters = append(c.disp.waiters[:i], c.disp.waiters[i+1:]...)
+		}
+		return true
+	}
+	c.disp.unsolicited++
+	return false
+}
+
+func (c *Chain) addWaiter(all bool, chipAddr byte, regAddr RegAddr) *waiter {
+	w := &waiter{all: all, chipAddr: chipAddr, regAddr: regAddr}
+	if all {
+		w.replies = make(chan RegisterReply, 256)
+	} else {
+		w.replies = make(chan RegisterReply, 1)
+	}
+	c.disp.mu.Lock()
+	c.disp.waiters = append(c.disp.waiters, w)
+	c.disp.mu.Unlock()
+	return w
+}
+
+func (c *Chain) removeWaiter(w *waiter) {
+	c.disp.mu.Lock()
+	defer c.disp.mu.Unlock()
+	for i, o := range c.disp.waiters {
+		if o == w {
+			c.disp.waiters = append(c.disp.waiters[:i], c.disp.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// pump reads and dispatches one frame for w when nobody is listening.
+func (c *Chain) pump(w *waiter) error {
+	resp, err := c.readResponse()
+	if err != nil {
+		return err
+	}
+	if !c.dispatch(resp) {
+		return &UnexpectedResponseError{WantChipAddr: w.chipAddr, WantRegAddr: w.regAddr, Got: *resp.Register}
+	}
+	return nil
+}
+
+func (c *Chain) commandTimeout() time.Duration {
+	if c.CommandTimeout > 0 {
+		return c.CommandTimeout
+	}
+	return responseTimeout
+}
+
+// sleep waits d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// await returns the reply of a unicast waiter.
+func (c *Chain) await(ctx context.Context, w *waiter) (RegisterReply, error) {
+	listening, failed := c.listenState()
+	if !listening {
+		for {
+			select {
+			case reply := <-w.replies:
+				return reply, nil
+			default:
+			}
+			if err := ctx.Err(); err != nil {
+				return RegisterReply{}, err
+			}
+			// the bytes dropped before a frame are no reply
+			if err := c.pump(w); err != nil && !errors.Is(err, ErrPreamble) {
+				return RegisterReply{}, err
+			}
+		}
+	}
+	t := time.NewTimer(c.commandTimeout())
+	defer t.Stop()
+	select {
+	case reply := <-w.replies:
+		return reply, nil
+	case <-t.C:
+		return RegisterReply{}, ErrTimeout
+	case <-failed:
+		return RegisterReply{}, c.listenErr()
+	case <-ctx.Done():
+		return RegisterReply{}, ctx.Err()
+	}
+}
+
+// collect returns the replies of a broadcast waiter, until the transport has nothing
+// more to read or, when listening, until no reply came during the command timeout.
+func (c *Chain) collect(ctx context.Context, w *waiter) ([]RegisterReply, error) {
+	var replies []RegisterReply
+	listening, failed := c.listenState()
+	if !listening {
+		for {
+			if err := ctx.Err(); err != nil {
+				return replies, err
+			}
+			err := c.pump(w)
+			for len(w.replies) > 0 {
+				replies = append(replies, <-w.replies)
+			}
+			if err == io.EOF {
+				return replies, nil
+			}
+			if err != nil && !errors.Is(err, ErrPreamble) {
+				return replies, err
+			}
+		}
+	}
+	for {
+		select {
+		case reply := <-w.replies:
+			replies = append(replies, reply)
+		case <-time.After(c.commandTimeout()):
+			return replies, nil
+		case <-failed:
+			return replies, c.listenErr()
+		case <-ctx.Done():
+			return replies, ctx.Err()
+		}
+	}
+}
+
+// readRegister reads a register of one chip and waits for its reply, retrying
+// according to the chain retry policy.
+func (c *Chain) readRegister(ctx context.Context, chipAddr byte, regAddr RegAddr) (uint32, error) {
+	var regVal uint32
+	err := c.retry(ctx, func() error {
+		w := c.addWaiter(false, chipAddr, regAddr)
+		defer c.removeWaiter(w)
+		if err := c.ReadRegister(false, chipAddr, regAddr); err != nil {
+			return err
+		}
+		reply, err := c.await(ctx, w)
+		regVal = reply.Value
+		return err
+	})
+	return regVal, err
+}
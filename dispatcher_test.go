@@ -0,0 +1,236 @@
+package bm13xx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// lockedBuffer is a port safe to use from the listening goroutine,
+// answers are made readable one by one, on every write.
+type lockedBuffer struct {
+	mu      sync.Mutex
+	rx      bytes.Buffer
+	out     bytes.Buffer
+	answers [][]byte
+}
+
+func (b *lockedBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rx.Read(p)
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.answers) > 0 {
+		b.rx.Write(b.answers[0])
+		b.answers = b.answers[1:]
+	}
+	return b.out.Write(p)
+}
+
+func TestChain_readRegister(t *testing.T) {
+	nonce := []byte{0xAA, 0x55, 0x7C, 0x2B, 0xAC, 0x1D, 0x00, 0x32, 0x97}
+	miscCtrl := []byte{0xAA, 0x55, 0x00, 0x00, 0x61, 0x31, 0x00, 0x18, 0x04}
+	tests := []struct {
+		name      string
+		listen    bool
+		rx        []byte
+		want      uint32
+		wantNonce NonceReply
+		wantErr   error
+	}{
+		{
+			name:      "nonce before register reply",
+			rx:        append(append([]byte{}, nonce...), miscCtrl...),
+			want:      0x6131,
+			wantNonce: NonceReply{Nonce: 0x7C2BAC1D, Midstate: 2, JobID: 0x30},
+		},
+		{
+			name:      "listening",
+			listen:    true,
+			rx:        append(append([]byte{}, nonce...), miscCtrl...),
+			want:      0x6131,
+			wantNonce: NonceReply{Nonce: 0x7C2BAC1D, Midstate: 2, JobID: 0x30},
+		},
+		{
+			name:    "no reply",
+			wantErr: io.EOF,
+		},
+		{
+			name:    "no reply listening",
+			listen:  true,
+			wantErr: ErrTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := &lockedBuffer{answers: [][]byte{tt.rx}}
+			c := NewChain(port, true, 25000000)
+			if tt.listen {
+				if err := c.Listen(); err != nil {
+					t.Fatal(err)
+				}
+				defer c.StopListening()
+			}
+			got, err := c.readRegister(context.Background(), 0, MiscControl)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Chain.readRegister() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Chain.readRegister() = 0x%08X, want 0x%08X", got, tt.want)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			select {
+			case n := <-c.Nonces():
+				if !cmp.Equal(n, tt.wantNonce) {
+					t.Errorf("Chain.Nonces() = %v, want %v", n, tt.wantNonce)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("Chain.Nonces() got nothing")
+			}
+		})
+	}
+}
+
+func TestChain_readRegister_unexpected(t *testing.T) {
+	// ChipAddress of chip 0x08 while reading MiscControl of chip 0x00
+	chipAddr := []byte{0xAA, 0x55, 0x13, 0x97, 0x18, 0x08, 0x08, 0x00, 0x0B}
+	c := NewChain(&lockedBuffer{answers: [][]byte{chipAddr}}, true, 25000000)
+	_, err := c.readRegister(context.Background(), 0, MiscControl)
+	var unexpected *UnexpectedResponseError
+	if !errors.As(err, &unexpected) {
+		t.Fatalf("Chain.readRegister() error = %v, want an UnexpectedResponseError", err)
+	}
+	want := UnexpectedResponseError{
+		WantChipAddr: 0x00,
+		WantRegAddr:  MiscControl,
+		Got:          RegisterReply{Value: 0x13971808, ChipAddr: 0x08, RegAddr: ChipAddress},
+	}
+	if *unexpected != want {
+		t.Errorf("Chain.readRegister() error = %+v, want %+v", *unexpected, want)
+	}
+}
+
+// closedPort fails every read, like a port closed under the listener.
+type closedPort struct{ bytes.Buffer }
+
+func (p *closedPort) Read([]byte) (int, error) {
+	return 0, os.ErrClosed
+}
+
+func TestChain_listen_closed(t *testing.T) {
+	c := NewChain(&closedPort{}, true, 25000000)
+	c.CommandTimeout = time.Minute
+	if err := c.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopListening()
+	if _, err := c.ReadRegisterContext(context.Background(), 0, MiscControl); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Chain.ReadRegisterContext() error = %v, want %v", err, os.ErrClosed)
+	}
+	if c.isListening() {
+		t.Errorf("Chain still listening on a closed port")
+	}
+}
+
+func TestChain_ensureListening(t *testing.T) {
+	miscCtrl := []byte{0xAA, 0x55, 0x00, 0x00, 0x61, 0x31, 0x00, 0x18, 0x04}
+	port := &lockedBuffer{answers: [][]byte{miscCtrl, miscCtrl}}
+	c := NewChain(port, true, 25000000)
+	if _, err := c.ReadRegisterContext(context.Background(), 0, MiscControl); err != nil {
+		t.Fatal(err)
+	}
+	// the context call listened only while it ran
+	if c.isListening() {
+		t.Fatalf("Chain still listening after Chain.ReadRegisterContext()")
+	}
+	if err := c.ReadRegister(false, 0, MiscControl); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _, err := c.GetResponse(); err != nil || got != 0x6131 {
+		t.Errorf("Chain.GetResponse() = 0x%08X, %v, want 0x00006131", got, err)
+	}
+	// nor does it stop a listener started by Listen
+	if err := c.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopListening()
+	port.mu.Lock()
+	port.answers = [][]byte{miscCtrl}
+	port.mu.Unlock()
+	if _, err := c.ReadRegisterContext(context.Background(), 0, MiscControl); err != nil {
+		t.Fatal(err)
+	}
+	if !c.isListening() {
+		t.Errorf("Chain.ReadRegisterContext() stopped the listener started by Listen")
+	}
+}
+
+func TestChain_retry(t *testing.T) {
+	miscCtrl := []byte{0xAA, 0x55, 0x00, 0x00, 0x61, 0x31, 0x00, 0x18, 0x04}
+	badMiscCtrl := []byte{0xAA, 0x55, 0x00, 0x00, 0x61, 0x31, 0x00, 0x18, 0x05}
+	tests := []struct {
+		name        string
+		retry       RetryPolicy
+		answers     [][]byte
+		want        uint32
+		wantErr     error
+		wantRetries uint64
+	}{
+		{
+			name:    "no retry",
+			answers: [][]byte{badMiscCtrl, miscCtrl},
+			wantErr: ErrCRC,
+		},
+		{
+			name:        "retried after a bad crc",
+			retry:       RetryPolicy{Attempts: 3, Backoff: time.Millisecond},
+			answers:     [][]byte{badMiscCtrl, miscCtrl},
+			want:        0x6131,
+			wantRetries: 1,
+		},
+		{
+			name:        "attempts exhausted",
+			retry:       RetryPolicy{Attempts: 2},
+			answers:     [][]byte{badMiscCtrl, badMiscCtrl, miscCtrl},
+			wantErr:     ErrCRC,
+			wantRetries: 1,
+		},
+		{
+			name: "not retryable",
+			retry: RetryPolicy{Attempts: 3, Retryable: func(err error) bool {
+				return errors.Is(err, ErrTimeout)
+			}},
+			answers: [][]byte{badMiscCtrl, miscCtrl},
+			wantErr: ErrCRC,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChain(&lockedBuffer{answers: tt.answers}, true, 25000000)
+			c.Retry = tt.retry
+			got, err := c.readRegister(context.Background(), 0, MiscControl)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Chain.readRegister() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Chain.readRegister() = 0x%08X, want 0x%08X", got, tt.want)
+			}
+			if retries := c.Stats().Retries; retries != tt.wantRetries {
+				t.Errorf("Chain.Stats().Retries = %d, want %d", retries, tt.wantRetries)
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+// Package emulator models a daisy chain of bm13xx chips behind a UART, answering
+// like silicon so that bm13xx.Chain can be exercised without hardware.
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/GPTechinno/go-bm13xx"
+	"github.com/snksoft/crc"
+)
+
+func crc5(data []byte) byte {
+	crc5 := crc.NewHash(&crc.Parameters{Width: 5, Polynomial: 0x05, Init: 0x1F, ReflectIn: false, ReflectOut: false, FinalXor: 0x00})
+	return byte(crc5.CalculateCRC(data))
+}
+
+func crc16(data []byte) uint16 {
+	crc16 := crc.NewHash(crc.CCITT)
+	return uint16(crc16.CalculateCRC(data))
+}
+
+type op byte
+
+const (
+	opJob op = iota
+	opSetChipAddr
+	opWriteRegister
+	opReadRegister
+	opChainInactive
+	opUnknown
+)
+
+// Command codes (low nibble) of the BM1397 and later, and of the BM1387
+var (
+	bm1397Ops = map[byte]op{0x0: opSetChipAddr, 0x1: opWriteRegister, 0x2: opReadRegister, 0x3: opChainInactive}
+	bm1387Ops = map[byte]op{0x1: opSetChipAddr, 0x8: opWriteRegister, 0x4: opReadRegister, 0x5: opChainInactive}
+)
+
+// Stats counts what the emulated chain received.
+type Stats struct {
+	Commands  uint64 // valid commands
+	Jobs      uint64 // valid jobs
+	CRCErrors uint64 // frames dropped because of a bad crc
+	Discarded uint64 // bytes dropped while hunting for a frame
+	Hashes    uint64 // SHA-256d computed by all cores
+	Nonces    uint64 // nonces meeting the TicketMask difficulty
+}
+
+type chip struct {
+	addr     byte
+	inactive bool
+	regs     map[bm13xx.RegAddr]uint32
+	coreRegs []map[bm13xx.CoreRegID]uint16
+}
+
+// Chain is a bm13xx.Transport behaving like the UART of a chain of chips.
+type Chain struct {
+	// How long Read waits for a response before returning io.EOF,
+	// like a tty configured with a read timeout.
+	ReadTimeout time.Duration
+	// Hashes per second computed by each core, hashing is done while the host
+	// reads the chain. 0 leaves the jobs untouched.
+	CoreHashrate float64
+
+	mu       sync.Mutex
+	model    *bm13xx.ChipModel
+	chips    []*chip
+	in       []byte
+	out      bytes.Buffer
+	notify   chan struct{}
+	stats    Stats
+	job      *job
+	lastHash time.Time
+	credit   float64
+	speed    int // host port speed, 0 until SetSpeed
+}
+
+// clki is the reference clock of the emulated chips, Hz.
+const clki = 25000000
+
+// New returns a chain of n chips of the given model, in their reset state.
+func New(model *bm13xx.ChipModel, n int) *Chain {
+	e := &Chain{model: model, notify: make(chan struct{}, 1)}
+	for i := 0; i < n; i++ {
+		c := &chip{regs: resetRegs(model)}
+		for j := 0; j < model.Cores; j++ {
+			c.coreRegs = append(c.coreRegs, make(map[bm13xx.CoreRegID]uint16))
+		}
+		e.chips = append(e.chips, c)
+	}
+	return e
+}
+
+func resetRegs(model *bm13xx.ChipModel) map[bm13xx.RegAddr]uint32 {
+	regs := make(map[bm13xx.RegAddr]uint32)
+	for _, reg := range model.Registers {
+		regs[reg] = 0
+	}
+	coreNum := uint32(model.Cores)
+	if model.ChipID == 0x1397 || model.ChipID == 0x1398 {
+		// what the silicon actually reports
+		coreNum = 0x18
+	}
+	chipAddress := bm13xx.ChipAddressReg{ChipID: model.ChipID, CoreNum: byte(coreNum)}
+	regs[bm13xx.ChipAddress] = chipAddress.Encode()
+	if model.Preamble {
+		// undocumented but answering
+		for _, reg := range []bm13xx.RegAddr{0x24, 0x30, 0x34, 0x88} {
+			regs[reg] = 0
+		}
+		// BT8D = 26 for 115200 bauds
+		regs[bm13xx.MiscControl] = 0x00003A01
+		regs[bm13xx.PLL0Parameter] = 0xC0600161
+		regs[bm13xx.PLL3Parameter] = 0xC0700111
+		regs[bm13xx.FastUARTConfiguration] = 0x0600000F
+	} else {
+		regs[bm13xx.BM1387MiscControl] = 0x40201A00
+		regs[bm13xx.BM1387PLLParameter] = 0x00200241
+	}
+	return regs
+}
+
+// Reg returns the current value of a register of a chip, by position in the chain.
+func (e *Chain) Reg(chipIndex int, regAddr bm13xx.RegAddr) uint32 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.chips[chipIndex].regs[regAddr]
+}
+
+// SetReg forces a register of a chip, by position in the chain.
+func (e *Chain) SetReg(chipIndex int, regAddr bm13xx.RegAddr, regVal uint32) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.chips[chipIndex].regs[regAddr] = regVal
+}
+
+// CoreReg returns the current value of a core register of a chip, by position in the chain.
+func (e *Chain) CoreReg(chipIndex int, coreID int, id bm13xx.CoreRegID) uint16 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.chips[chipIndex].coreRegs[coreID][id]
+}
+
+// Stats returns what the chain received so far.
+func (e *Chain) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// SetSpeed switches the host side of the line. From then on, the chain only
+// understands and is understood when its UART runs within 5% of it.
+func (e *Chain) SetSpeed(baud int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.speed = baud
+	return nil
+}
+
+// inSync tells if the first chip UART matches the host speed.
+func (e *Chain) inSync() bool {
+	if e.speed == 0 || len(e.chips) == 0 {
+		return true
+	}
+	return math.Abs(e.baud(e.chips[0])-float64(e.speed)) <= float64(e.speed)*0.05
+}
+
+// baud returns the speed of the UART of a chip, from its dividers.
+func (e *Chain) baud(c *chip) float64 {
+	if !e.model.Preamble {
+		var misc bm13xx.BM1387MiscControlReg
+		misc.Decode(c.regs[bm13xx.BM1387MiscControl])
+		return clki / float64((int(misc.BT8D)+1)*8)
+	}
+	var misc bm13xx.MiscControlReg
+	misc.Decode(c.regs[bm13xx.MiscControl])
+	uartClk := float64(clki)
+	if misc.BClkSel {
+		// fast UART clock is PLL3 / (PLL3_DIV4 + 1)
+		var pll3 bm13xx.PLLParameterReg
+		pll3.Decode(c.regs[bm13xx.PLL3Parameter])
+		divide := float64(int(pll3.RefDiv) * int(pll3.PostDiv1) * int(pll3.PostDiv2))
+		if divide == 0 {
+			return 0
+		}
+		var fastUART bm13xx.FastUARTConfigReg
+		fastUART.Decode(c.regs[bm13xx.FastUARTConfiguration])
+		uartClk = uartClk * float64(pll3.FBDiv) / divide / float64(fastUART.PLL3Div4+1)
+	}
+	return uartClk / float64((int(misc.BT8D)+1)*8)
+}
+
+// Read returns the pending responses, waiting up to ReadTimeout for some.
+func (e *Chain) Read(p []byte) (int, error) {
+	var timeout <-chan time.Time
+	for {
+		e.mu.Lock()
+		e.hash()
+		if !e.inSync() {
+			// garbled at the host speed
+			e.out.Reset()
+		}
+		if e.out.Len() > 0 {
+			n, err := e.out.Read(p)
+			e.mu.Unlock()
+			return n, err
+		}
+		e.mu.Unlock()
+		if e.ReadTimeout == 0 {
+			return 0, io.EOF
+		}
+		if timeout == nil {
+			timeout = time.After(e.ReadTimeout)
+		}
+		select {
+		case <-e.notify:
+		case <-time.After(hashTick):
+		case <-timeout:
+			return 0, io.EOF
+		}
+	}
+}
+
+// Write feeds commands to the first chip of the chain.
+func (e *Chain) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.inSync() {
+		e.stats.Discarded += uint64(len(p))
+		return len(p), nil
+	}
+	e.in = append(e.in, p...)
+	for e.parse() {
+	}
+	return len(p), nil
+}
+
+// parse handles the first frame of the input buffer, it returns false when more
+// bytes are needed.
+func (e *Chain) parse() bool {
+	if e.model.Preamble {
+		i := bytes.Index(e.in, []byte{0x55, 0xAA})
+		if i < 0 {
+			return false
+		}
+		e.stats.Discarded += uint64(i)
+		if len(e.in) < i+4 {
+			e.in = e.in[i:]
+			return false
+		}
+		e.in = e.in[i:]
+		frame, ok := e.frame(e.in[2:])
+		if frame == nil {
+			return false
+		}
+		if !ok {
+			e.in = e.in[2:]
+			return true
+		}
+		e.in = e.in[2+len(frame):]
+		e.exec(frame)
+		return true
+	}
+	if len(e.in) < 2 {
+		return false
+	}
+	frame, ok := e.frame(e.in)
+	if frame == nil {
+		return false
+	}
+	if !ok {
+		// no way to resync but sliding
+		e.in = e.in[1:]
+		e.stats.Discarded++
+		return true
+	}
+	e.in = e.in[len(frame):]
+	e.exec(frame)
+	return true
+}
+
+// frame returns the complete frame at the start of buf, nil if incomplete,
+// with false if its crc is bad.
+func (e *Chain) frame(buf []byte) ([]byte, bool) {
+	length := int(buf[1])
+	if length < 5 {
+		e.stats.CRCErrors++
+		return buf[:0], false
+	}
+	if len(buf) < length {
+		return nil, false
+	}
+	frame := buf[:length]
+	if buf[0]&0xf0 == 0x20 {
+		if crc16(frame[:length-2]) != binary.BigEndian.Uint16(frame[length-2:]) {
+			e.stats.CRCErrors++
+			return frame, false
+		}
+		return frame, true
+	}
+	if crc5(frame[:length-1]) != frame[length-1] {
+		e.stats.CRCErrors++
+		return frame, false
+	}
+	return frame, true
+}
+
+func (e *Chain) decodeOp(code byte) (op, bool) {
+	if code&0xf0 == 0x20 {
+		return opJob, false
+	}
+	if code&0xe0 != 0x40 {
+		return opUnknown, false
+	}
+	ops := bm1397Ops
+	if !e.model.Preamble {
+		ops = bm1387Ops
+	}
+	o, exist := ops[code&0x0f]
+	if !exist {
+		return opUnknown, false
+	}
+	return o, code&0x10 != 0
+}
+
+func (e *Chain) exec(frame []byte) {
+	o, all := e.decodeOp(frame[0])
+	switch o {
+	case opJob:
+		if j := e.parseJob(frame); j != nil {
+			e.stats.Jobs++
+			// every core restarts on the new job
+			e.job = j
+			e.lastHash = time.Now()
+			e.credit = 0
+		}
+		return
+	case opUnknown:
+		return
+	}
+	e.stats.Commands++
+	chipAddr := frame[2]
+	regAddr := bm13xx.RegAddr(frame[3])
+	switch o {
+	case opChainInactive:
+		for _, c := range e.chips {
+			c.inactive = true
+		}
+	case opSetChipAddr:
+		// taken by the first chip not addressed since ChainInactive
+		for _, c := range e.chips {
+			if c.inactive {
+				c.inactive = false
+				c.addr = chipAddr
+				c.regs[bm13xx.ChipAddress] = c.regs[bm13xx.ChipAddress]&0xffffff00 | uint32(chipAddr)
+				break
+			}
+		}
+	case opWriteRegister:
+		if len(frame) < 9 {
+			return
+		}
+		regVal := binary.BigEndian.Uint32(frame[4:])
+		for _, c := range e.chips {
+			if all || c.addr == chipAddr {
+				e.writeReg(c, regAddr, regVal)
+			}
+		}
+	case opReadRegister:
+		for _, c := range e.chips {
+			if all || c.addr == chipAddr {
+				if regVal, exist := c.regs[regAddr]; exist {
+					e.respond(regVal, c.addr, byte(regAddr))
+				}
+			}
+		}
+	}
+}
+
+func (e *Chain) writeReg(c *chip, regAddr bm13xx.RegAddr, regVal uint32) {
+	if _, exist := c.regs[regAddr]; !exist {
+		return
+	}
+	switch {
+	case regAddr == bm13xx.ChipAddress:
+		// read only
+		return
+	case e.model.CoreRegs && regAddr == bm13xx.CoreRegisterControl:
+		e.coreRegisterControl(c, regVal)
+	case e.model.PLLEnableBits && isPLL(regAddr):
+		// PLL locks as soon as enabled
+		var pll bm13xx.PLLParameterReg
+		pll.Decode(regVal)
+		pll.Locked = pll.PLLEn
+		regVal = pll.Encode()
+	}
+	c.regs[regAddr] = regVal
+}
+
+func isPLL(regAddr bm13xx.RegAddr) bool {
+	switch regAddr {
+	case bm13xx.PLL0Parameter, bm13xx.PLL1Parameter, bm13xx.PLL2Parameter, bm13xx.PLL3Parameter:
+		return true
+	}
+	return false
+}
+
+func (e *Chain) coreRegisterControl(c *chip, regVal uint32) {
+	var ctrl bm13xx.CoreRegisterControlReg
+	ctrl.Decode(regVal)
+	coreID, id := int(ctrl.CoreID), ctrl.CoreRegID
+	if coreID >= len(c.coreRegs) {
+		return
+	}
+	if ctrl.Write {
+		c.coreRegs[coreID][id] = uint16(ctrl.Value)
+		return
+	}
+	value := bm13xx.CoreRegisterValueReg{CoreID: uint16(coreID), Value: c.coreRegs[coreID][id]}
+	val := value.Encode()
+	c.regs[bm13xx.CoreRegisterValue] = val
+	e.respond(val, c.addr, byte(bm13xx.CoreRegisterValue))
+}
+
+// respond queues a register reply frame for the host.
+func (e *Chain) respond(regVal uint32, chipAddr byte, regAddr byte) {
+	frame := make([]byte, 4, 9)
+	binary.BigEndian.PutUint32(frame, regVal)
+	frame = append(frame, chipAddr, regAddr)
+	if e.model.JobFormat == bm13xx.FullHeaderJobFormat {
+		frame = append(frame, 0, 0)
+	}
+	e.send(seal(append(frame, 0)))
+}
+
+// seal sets the crc5 in the 5 lowest bits of the last byte of a response,
+// the 3 highest bits being covered by it.
+func seal(frame []byte) []byte {
+	last := len(frame) - 1
+	flags := frame[last] & 0xe0
+	for c := byte(0); c < 0x20; c++ {
+		frame[last] = flags | c
+		if crc5(frame) == 0x00 {
+			break
+		}
+	}
+	return frame
+}
+
+func (e *Chain) send(frame []byte) {
+	if e.model.Preamble {
+		e.out.Write([]byte{0xAA, 0x55})
+	}
+	e.out.Write(frame)
+	select {
+	case e.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,710 @@
+package emulator
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GPTechinno/go-bm13xx"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestChain_Init(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     *bm13xx.ChipModel
+		chips     int
+		increment byte
+		wantBaud  int
+		wantAddrs []byte
+	}{
+		{
+			name:      "4 BM1397",
+			model:     bm13xx.BM1397,
+			chips:     4,
+			increment: 8,
+			wantBaud:  1562500,
+			wantAddrs: []byte{0, 8, 16, 24},
+		},
+		{
+			name:      "3 BM1387",
+			model:     bm13xx.BM1387,
+			chips:     3,
+			increment: 4,
+			wantBaud:  115200,
+			wantAddrs: []byte{0, 4, 8},
+		},
+		{
+			name:      "2 BM1366",
+			model:     bm13xx.BM1366,
+			chips:     2,
+			increment: 128,
+			wantBaud:  1041666,
+			wantAddrs: []byte{0, 128},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := New(tt.model, tt.chips)
+			c := bm13xx.NewChainForModel(emu, tt.model, 25000000)
+			baud, err := c.Init(tt.increment)
+			if err != nil {
+				t.Fatalf("Chain.Init() error = %v", err)
+			}
+			if baud != tt.wantBaud {
+				t.Errorf("Chain.Init() = %d, want %d", baud, tt.wantBaud)
+			}
+			if c.Model() != tt.model {
+				t.Errorf("Chain.Model() = %v, want %v", c.Model(), tt.model)
+			}
+			if len(c.Asics) != len(tt.wantAddrs) {
+				t.Fatalf("Chain.Asics = %d chips, want %d", len(c.Asics), len(tt.wantAddrs))
+			}
+			for i, a := range c.Asics {
+				if a.Addr() != tt.wantAddrs[i] {
+					t.Errorf("chip %d addr = %d, want %d", i, a.Addr(), tt.wantAddrs[i])
+				}
+				if got := byte(emu.Reg(i, bm13xx.ChipAddress)); got != tt.wantAddrs[i] {
+					t.Errorf("emulated chip %d addr = %d, want %d", i, got, tt.wantAddrs[i])
+				}
+			}
+			last := len(c.Asics) - 1
+			if err := c.ReadAllRegisters(last); err != nil {
+				t.Fatalf("Chain.ReadAllRegisters() error = %v", err)
+			}
+			for reg, val := range c.Asics[last].Regs {
+				if want := emu.Reg(last, reg); val != want {
+					t.Errorf("register 0x%02X = 0x%08X, want 0x%08X", byte(reg), val, want)
+				}
+			}
+		})
+	}
+}
+
+func TestChain_SetBaudrate(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	if baud, err := c.SetBaudrate(3125000); err != nil || baud != 3125000 {
+		t.Fatalf("Chain.SetBaudrate() = %d, %v, want 3125000", baud, err)
+	}
+	for i := range c.Asics {
+		if miscCtrl := emu.Reg(i, bm13xx.MiscControl); (miscCtrl>>16)&0x01 != 1 {
+			t.Errorf("chip %d MiscControl = 0x%08X, want BCLK_SEL", i, miscCtrl)
+		}
+	}
+}
+
+func TestChain_ReadCoreRegister(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	// Init writes ClockDelayCtrl = 0x74 on core 0 of every chip
+	got, err := c.ReadCoreRegister(8, 0, bm13xx.ClockDelayCtrl)
+	if err != nil {
+		t.Fatalf("Chain.ReadCoreRegister() error = %v", err)
+	}
+	if got != 0x74 {
+		t.Errorf("Chain.ReadCoreRegister() = 0x%04X, want 0x0074", got)
+	}
+}
+
+func TestChain_Init_unknownModel(t *testing.T) {
+	model := *bm13xx.BM1397
+	model.ChipID = 0x1391
+	emu := New(&model, 2)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatalf("Chain.Init() error = %v", err)
+	}
+	if got := c.Model(); got != nil {
+		t.Errorf("Chain.Model() = %v, want none", got)
+	}
+	if got := len(c.Chips()); got != 2 {
+		t.Errorf("Chain.Init() found %d chips, want 2", got)
+	}
+}
+
+func TestChain_badCRC(t *testing.T) {
+	emu := New(bm13xx.BM1397, 1)
+	emu.Write([]byte{0x55, 0xAA, 0x52, 0x05, 0x00, 0x00, 0x0B})
+	if got := emu.Stats(); got.CRCErrors != 1 || got.Commands != 0 {
+		t.Errorf("Chain.Stats() = %+v, want 1 CRC error", got)
+	}
+	if n, _ := emu.Read(make([]byte, 16)); n != 0 {
+		t.Errorf("Chain.Read() = %d bytes, want none", n)
+	}
+}
+
+func TestChain_hashing(t *testing.T) {
+	// genesis block header, its nonce 0x7C2BAC1D comes from chip 31 core 29
+	header, _ := hex.DecodeString("01000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"3ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a" +
+		"29ab5f49" + "ffff001d")
+	tests := []struct {
+		name   string
+		model  *bm13xx.ChipModel
+		jobID  byte
+		wantID byte
+	}{
+		{name: "BM1397 midstate", model: bm13xx.BM1397, jobID: 4, wantID: 4},
+		{name: "BM1387 midstate", model: bm13xx.BM1387, jobID: 3, wantID: 3},
+		{name: "BM1366 full header", model: bm13xx.BM1366, jobID: 8, wantID: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := New(tt.model, 2)
+			emu.CoreHashrate = 100
+			c := bm13xx.NewChainForModel(emu, tt.model, 25000000)
+			// second chip gets address 124, scanning the nonces of chip 31
+			if _, err := c.Init(124); err != nil {
+				t.Fatal(err)
+			}
+			// time for the cores to hash
+			emu.ReadTimeout = 2 * time.Second
+			var err error
+			if tt.model.JobFormat == bm13xx.FullHeaderJobFormat {
+				job := bm13xx.HeaderJob{JobID: tt.jobID, StartingNonce: 0x1DAC2B7C, NBits: 0x1D00FFFF, NTime: 0x495FAB29, Version: 1}
+				copy(job.MerkleRoot[:], header[36:68])
+				err = c.SendHeaderJob(job)
+			} else {
+				err = c.SendJob(tt.jobID, 0x1DAC2B7C, 0x1D00FFFF, 0x495FAB29, 0x4A5E1E4B, []bm13xx.Midstate{Midstate(header)})
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.ReadNonce()
+			if err != nil {
+				t.Fatalf("Chain.ReadNonce() error = %v", err)
+			}
+			if got.Nonce != 0x1DAC2B7C || got.Chip() != 31 || got.Core() != 29 {
+				t.Errorf("Chain.ReadNonce() = 0x%08X chip %d core %d, want 0x1DAC2B7C chip 31 core 29", uint32(got.Nonce), got.Chip(), got.Core())
+			}
+			if got.JobID != tt.wantID || got.Midstate != 0 {
+				t.Errorf("Chain.ReadNonce() job %d midstate %d, want job %d midstate 0", got.JobID, got.Midstate, tt.wantID)
+			}
+			if stats := emu.Stats(); stats.Jobs != 1 || stats.Nonces != 1 || stats.Hashes == 0 {
+				t.Errorf("Chain.Stats() = %+v, want 1 job and 1 nonce", stats)
+			}
+		})
+	}
+}
+
+func TestChain_InitContext(t *testing.T) {
+	// no read timeout, InitContext must not rely on the io.EOF ending the reads
+	emu := New(bm13xx.BM1397, 2)
+	c := bm13xx.NewChainForModel(emu, bm13xx.BM1397, 25000000)
+	c.CommandTimeout = 50 * time.Millisecond
+	defer c.StopListening()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.InitContext(ctx, 8); err != nil {
+		t.Fatalf("Chain.InitContext() error = %v", err)
+	}
+	if len(c.Asics) != 2 {
+		t.Fatalf("Chain.Asics = %d chips, want 2", len(c.Asics))
+	}
+	got, err := c.ReadRegisterContext(ctx, 8, bm13xx.TicketMask)
+	if err != nil {
+		t.Fatalf("Chain.ReadRegisterContext() error = %v", err)
+	}
+	if got != 0xF0 {
+		t.Errorf("Chain.ReadRegisterContext() = 0x%08X, want 0x000000F0", got)
+	}
+	// nobody at this address
+	if _, err := c.ReadRegisterContext(ctx, 0x42, bm13xx.TicketMask); err == nil {
+		t.Errorf("Chain.ReadRegisterContext() on a missing chip should time out")
+	}
+	cancel()
+	if err := c.ReadAllRegistersContext(ctx, 0); err != context.Canceled {
+		t.Errorf("Chain.ReadAllRegistersContext() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestChain_concurrent(t *testing.T) {
+	emu := New(bm13xx.BM1397, 4)
+	c := bm13xx.NewChainForModel(emu, bm13xx.BM1397, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopListening()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	// telemetry pollers
+	for i := range c.Chips() {
+		wg.Add(1)
+		go func(chipIndex int) {
+			defer wg.Done()
+			if err := c.ReadAllRegistersContext(ctx, chipIndex); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 4; i++ {
+			val, err := c.ReadCoreRegisterContext(ctx, byte(8*i), 0, bm13xx.ClockDelayCtrl)
+			if err != nil {
+				errs <- err
+			} else if val != 0x74 {
+				errs <- fmt.Errorf("chip %d ClockDelayCtrl = 0x%04X", i, val)
+			}
+		}
+	}()
+	// shadow writers, against readers holding reqMu only
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 40; i++ {
+			if err := c.WriteRegister(true, 0, bm13xx.TicketMask, 0xF0); err != nil {
+				errs <- err
+			}
+			if err := c.MarkStale(i%4, bm13xx.ErrorFlag); err != nil {
+				errs <- err
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 40; i++ {
+			if _, err := c.ChipFrequency(ctx, i%4); err != nil {
+				errs <- err
+			}
+		}
+	}()
+	// job sender
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := c.SendJob(byte(i*4), 0, 0, 0, 0, []bm13xx.Midstate{{}}); err != nil {
+				errs <- err
+			}
+			c.Chips()
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	for i, a := range c.Chips() {
+		if want := emu.Reg(i, bm13xx.MiscControl); a.Regs[bm13xx.MiscControl] != want {
+			t.Errorf("chip %d MiscControl = 0x%08X, want 0x%08X", i, a.Regs[bm13xx.MiscControl], want)
+		}
+	}
+	if got := emu.Stats().Jobs; got != 20 {
+		t.Errorf("emulated jobs = %d, want 20", got)
+	}
+}
+
+func TestChain_WriteCoreRegister(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	clkDly := bm13xx.ClockDelayCtrlReg{CCDlySel: 1, PWTHSel: 3, HashClkEn: true, MMEn: true}
+	if err := c.WriteCoreRegister(8, 3, bm13xx.ClockDelayCtrl, clkDly.Encode()); err != nil {
+		t.Fatalf("Chain.WriteCoreRegister() error = %v", err)
+	}
+	if got := emu.CoreReg(1, 3, bm13xx.ClockDelayCtrl); got != 0x7C {
+		t.Errorf("emulated core 3 ClockDelayCtrl = 0x%04X, want 0x007C", got)
+	}
+	if got := c.Chips()[1].CoreRegs[bm13xx.ClockDelayCtrl]; got != 0x7C {
+		t.Errorf("ClockDelayCtrl of chip 1 = 0x%04X, want 0x007C", got)
+	}
+	got, err := c.ReadCoreRegister(8, 3, bm13xx.ClockDelayCtrl)
+	if err != nil {
+		t.Fatalf("Chain.ReadCoreRegister() error = %v", err)
+	}
+	if got != 0x7C {
+		t.Errorf("Chain.ReadCoreRegister() = 0x%04X, want 0x007C", got)
+	}
+	if err := c.WriteCoreRegister(8, 3, bm13xx.ProcessMonitorData, 0x1234); !errors.Is(err, bm13xx.ErrOutOfRange) {
+		t.Errorf("Chain.WriteCoreRegister() error = %v, want %v", err, bm13xx.ErrOutOfRange)
+	}
+}
+
+func TestChain_WriteRegisterVerified(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	// LOCKED is set by the chips, not by the write
+	if err := c.WriteRegisterVerified(true, 0, bm13xx.PLL0Parameter, 0x40A80241); err != nil {
+		t.Fatalf("Chain.WriteRegisterVerified() error = %v", err)
+	}
+	if got := c.Chips()[1].Regs[bm13xx.PLL0Parameter]; got != 0xC0A80241 {
+		t.Errorf("Chain.Chips()[1] PLL0Parameter = 0x%08X, want 0xC0A80241", got)
+	}
+	// the emulated ChipAddress is read-only
+	err := c.WriteRegisterVerified(false, 8, bm13xx.ChipAddress, 0x13971842)
+	var verr *bm13xx.VerifyError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Chain.WriteRegisterVerified() error = %v, want a VerifyError", err)
+	}
+	want := []bm13xx.WriteMismatch{{ChipAddr: 8, Got: 0x13971808}}
+	if fmt.Sprint(verr.Mismatches) != fmt.Sprint(want) || verr.Mask != 0xff {
+		t.Errorf("Chain.WriteRegisterVerified() error = %+v, want mismatches %+v", verr, want)
+	}
+}
+
+func TestChain_shadow(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	// PLL0 LOCKED is read-only, kept from the read value
+	if err := c.ReadAllRegisters(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteRegister(false, 8, bm13xx.PLL0Parameter, 0x40A80241); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteRegisterVerified(true, 0, bm13xx.TicketMask, 0xFC); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MarkStale(1, bm13xx.ErrorFlag); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		chipIndex int
+		regAddr   bm13xx.RegAddr
+		want      uint32
+		wantState bm13xx.RegState
+	}{
+		{0, bm13xx.MiscControl, 0x6131, bm13xx.RegWritten},
+		{0, bm13xx.PLL0Parameter, 0, bm13xx.RegUnknown},
+		{0, bm13xx.TicketMask, 0xFC, bm13xx.RegVerified},
+		{1, bm13xx.PLL0Parameter, 0xC0A80241, bm13xx.RegWritten},
+		{1, bm13xx.TicketMask, 0xFC, bm13xx.RegVerified},
+		{1, bm13xx.HashRate, 0, bm13xx.RegKnown},
+		{1, bm13xx.ErrorFlag, 0, bm13xx.RegStale},
+	}
+	chips := c.Chips()
+	for _, tt := range tests {
+		got, state := chips[tt.chipIndex].Regs[tt.regAddr], chips[tt.chipIndex].State(tt.regAddr)
+		if got != tt.want || state != tt.wantState {
+			t.Errorf("chip %d register 0x%02X = 0x%08X %v, want 0x%08X %v",
+				tt.chipIndex, byte(tt.regAddr), got, state, tt.want, tt.wantState)
+		}
+	}
+}
+
+func TestChain_Probe(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	// Probe listens, the missing addresses take the whole command timeout
+	c.CommandTimeout = 50 * time.Millisecond
+	before := emu.Reg(1, bm13xx.MiscControl)
+	report, err := c.Probe(context.Background(), 1, bm13xx.ProbeOptions{Writability: true})
+	if err != nil {
+		t.Fatalf("Chain.Probe() error = %v", err)
+	}
+	// the undocumented registers answer too
+	if got, want := len(report.Registers), len(bm13xx.BM1397.Registers)+4; got != want {
+		t.Errorf("Chain.Probe() found %d registers, want %d", got, want)
+	}
+	for _, reg := range report.Registers {
+		if !reg.Known && reg.Toggled != 0 {
+			t.Errorf("unknown register 0x%02X toggled 0x%08X, want untouched", byte(reg.Addr), reg.Toggled)
+		}
+		switch reg.Addr {
+		case bm13xx.ChipAddress:
+			if reg.Toggled != 0 {
+				t.Errorf("ChipAddress toggled 0x%08X, want untouched", reg.Toggled)
+			}
+		case bm13xx.MiscControl:
+			if reg.Writable != 0xF0B0C0FF || !reg.Restored {
+				t.Errorf("MiscControl writable 0x%08X restored %t, want 0xF0B0C0FF restored", reg.Writable, reg.Restored)
+			}
+		}
+	}
+	if got := emu.Reg(1, bm13xx.MiscControl); got != before {
+		t.Errorf("emulated MiscControl = 0x%08X, want restored 0x%08X", got, before)
+	}
+	if got := len(report.Schema().Registers); got != 4 {
+		t.Errorf("ProbeReport.Schema() has %d registers, want the 4 undocumented ones", got)
+	}
+	report, err = c.Probe(context.Background(), 1, bm13xx.ProbeOptions{Writability: true, Unknown: true})
+	if err != nil {
+		t.Fatalf("Chain.Probe() error = %v", err)
+	}
+	for _, reg := range report.Registers {
+		if !reg.Known && (reg.Toggled == 0 || !reg.Restored) {
+			t.Errorf("unknown register 0x%02X toggled 0x%08X restored %t, want toggled and restored",
+				byte(reg.Addr), reg.Toggled, reg.Restored)
+		}
+	}
+}
+
+func TestChain_RampFrequency(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, target := range []float64{200, 425} {
+		got, err := c.RampFrequency(ctx, target, bm13xx.RampOptions{Step: 50, Dwell: time.Millisecond})
+		if err != nil || got != target {
+			t.Fatalf("Chain.RampFrequency(%v) = %v, %v", target, got, err)
+		}
+		for i, chip := range c.Chips() {
+			if freq, err := chip.PllFreq(0, 25000000); err != nil || freq != uint32(target*1e6) {
+				t.Errorf("chip %d PllFreq() = %d, %v, want %v MHz", i, freq, err, target)
+			}
+		}
+	}
+}
+
+// writeLossyPort loses the register writes when lossy, like a chip whose PLL
+// does not take a new setting.
+type writeLossyPort struct {
+	*Chain
+	lossy bool
+}
+
+func (p *writeLossyPort) Write(b []byte) (int, error) {
+	// 0x55 0xAA preamble, then the WriteRegister command, unicast or to all
+	if p.lossy && len(b) > 2 && b[2]&^0x10 == 0x41 {
+		return len(b), nil
+	}
+	return p.Chain.Write(b)
+}
+
+func TestChain_RampFrequency_fromWritten(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetFrequency(true, 0, 500); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := c.RampFrequency(ctx, math.NaN(), bm13xx.RampOptions{}); !errors.Is(err, bm13xx.ErrOutOfRange) {
+		t.Errorf("Chain.RampFrequency(NaN) error = %v, want ErrOutOfRange", err)
+	}
+	before := emu.Stats().Commands
+	got, err := c.RampFrequency(ctx, 510, bm13xx.RampOptions{Step: 5, Dwell: time.Millisecond})
+	if err != nil || got != 510 {
+		t.Fatalf("Chain.RampFrequency(510) = %v, %v", got, err)
+	}
+	// PLL0 read once, then 2 steps each written and read back from 2 chips
+	if n := emu.Stats().Commands - before; n != 7 {
+		t.Errorf("Chain.RampFrequency(510) sent %d commands, want 7 ramping from 500 MHz", n)
+	}
+}
+
+func TestChain_SetChipFrequency(t *testing.T) {
+	emu := New(bm13xx.BM1397, 3)
+	port := &writeLossyPort{Chain: emu}
+	c := bm13xx.NewChain(port, true, 25000000)
+	defer c.StopListening()
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := c.SetFrequency(true, 0, 300); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.SetChipFrequency(ctx, 1, 250); err != nil || got != 250 {
+		t.Fatalf("Chain.SetChipFrequency() = %v, %v", got, err)
+	}
+	if _, err := c.SetChipFrequency(ctx, 3, 250); !errors.Is(err, bm13xx.ErrOutOfRange) {
+		t.Errorf("Chain.SetChipFrequency() of a missing chip error = %v, want %v", err, bm13xx.ErrOutOfRange)
+	}
+	// chip 1 keeps 250 MHz, which is what it must still report
+	port.lossy = true
+	if got, err := c.SetChipFrequency(ctx, 1, 200); !errors.Is(err, bm13xx.ErrNotLocked) || got != 250 {
+		t.Errorf("Chain.SetChipFrequency() of a lossy chip = %v, %v, want 250, %v", got, err, bm13xx.ErrNotLocked)
+	}
+	port.lossy = false
+	want := []bm13xx.ChipInfo{
+		{Index: 0, Addr: 0x00, ChipID: 0x1397, Model: "BM1397", CoreNum: 0x18, Freq: 300},
+		{Index: 1, Addr: 0x08, ChipID: 0x1397, Model: "BM1397", CoreNum: 0x18, Freq: 250},
+		{Index: 2, Addr: 0x10, ChipID: 0x1397, Model: "BM1397", CoreNum: 0x18, Freq: 300},
+	}
+	if got := c.Inventory(); !cmp.Equal(got, want) {
+		t.Errorf("Chain.Inventory() mismatch (-got +want):\n%s", cmp.Diff(got, want))
+	}
+	for i, wantFreq := range []float64{300, 250, 300} {
+		if got, err := c.ChipFrequency(ctx, i); err != nil || got != wantFreq {
+			t.Errorf("Chain.ChipFrequency(%d) = %v, %v, want %v", i, got, err, wantFreq)
+		}
+	}
+}
+
+// deafPort loses what is written until the host switches speed, like chips
+// missing a baudrate change.
+type deafPort struct {
+	*Chain
+	deaf bool
+}
+
+func (p *deafPort) Write(b []byte) (int, error) {
+	if p.deaf {
+		return len(b), nil
+	}
+	return p.Chain.Write(b)
+}
+
+func (p *deafPort) SetSpeed(baud int) error {
+	p.deaf = false
+	return p.Chain.SetSpeed(baud)
+}
+
+func TestChain_switchBaudrate(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	emu.SetSpeed(bm13xx.ResetBaudrate)
+	port := &deafPort{Chain: emu}
+	c := bm13xx.NewChain(port, true, 25000000)
+	defer c.StopListening()
+	if baud, err := c.Init(8); err != nil || baud != 1562500 {
+		t.Fatalf("Chain.Init() = %d, %v, want 1562500", baud, err)
+	}
+	if baud, err := c.SetBaudrate(3125000); err != nil || baud != 3125000 || c.Baudrate() != 3125000 {
+		t.Fatalf("Chain.SetBaudrate() = %d, %v, want 3125000", baud, err)
+	}
+	// the chips miss the change, the host goes back to their speed
+	port.deaf = true
+	if baud, err := c.SetBaudrate(1000000); err == nil || baud != 3125000 || c.Baudrate() != 3125000 {
+		t.Errorf("Chain.SetBaudrate() = %d, %v, want 3125000 and an error", baud, err)
+	}
+	if state := c.Chips()[1].State(bm13xx.MiscControl); state != bm13xx.RegStale {
+		t.Errorf("MiscControl state = %v, want %v", state, bm13xx.RegStale)
+	}
+	if got, err := c.ReadRegisterContext(context.Background(), 8, bm13xx.TicketMask); err != nil || got != 0xF0 {
+		t.Errorf("Chain.ReadRegisterContext() = 0x%08X, %v, want 0x000000F0", got, err)
+	}
+}
+
+// deafAtPort loses what the chain answers while the host runs at speed, like
+// a link too marginal for it.
+type deafAtPort struct {
+	*Chain
+	speed int
+}
+
+func (p *deafAtPort) Read(b []byte) (int, error) {
+	n, err := p.Chain.Read(b)
+	p.mu.Lock()
+	deaf := p.Chain.speed == p.speed
+	p.mu.Unlock()
+	if deaf {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func TestChain_switchBaudrate_restore(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	emu.SetSpeed(bm13xx.ResetBaudrate)
+	port := &deafAtPort{Chain: emu, speed: 3125000}
+	c := bm13xx.NewChain(port, true, 25000000)
+	c.CommandTimeout = 50 * time.Millisecond
+	defer c.StopListening()
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	// the chips take the new speed, but do not answer at it
+	if baud, err := c.SetBaudrate(3125000); err == nil || baud != 1562500 || c.Baudrate() != 1562500 {
+		t.Errorf("Chain.SetBaudrate() = %d, %v, want 1562500 and an error", baud, err)
+	}
+	var misc bm13xx.MiscControlReg
+	misc.Decode(emu.Reg(1, bm13xx.MiscControl))
+	if misc.BClkSel || misc.BT8D != 1 {
+		t.Errorf("MiscControl = %+v, want the 1562500 bauds setting back", misc)
+	}
+	if got, err := c.ReadRegisterContext(context.Background(), 8, bm13xx.TicketMask); err != nil || got != 0xF0 {
+		t.Errorf("Chain.ReadRegisterContext() = 0x%08X, %v, want 0x000000F0", got, err)
+	}
+}
+
+// stuckPort fails to switch the host to speed once, after the chips took it.
+type stuckPort struct {
+	*Chain
+	speed  int
+	failed bool
+}
+
+func (p *stuckPort) SetSpeed(baud int) error {
+	if baud == p.speed && !p.failed {
+		p.failed = true
+		return errors.New("speed not supported")
+	}
+	return p.Chain.SetSpeed(baud)
+}
+
+func TestChain_switchBaudrate_speedFailure(t *testing.T) {
+	emu := New(bm13xx.BM1397, 2)
+	emu.SetSpeed(bm13xx.ResetBaudrate)
+	port := &stuckPort{Chain: emu, speed: 3125000}
+	c := bm13xx.NewChain(port, true, 25000000)
+	defer c.StopListening()
+	if _, err := c.Init(8); err != nil {
+		t.Fatal(err)
+	}
+	if baud, err := c.SetBaudrate(3125000); err == nil || baud != 1562500 || c.Baudrate() != 1562500 {
+		t.Errorf("Chain.SetBaudrate() = %d, %v, want 1562500 and an error", baud, err)
+	}
+	var misc bm13xx.MiscControlReg
+	misc.Decode(emu.Reg(1, bm13xx.MiscControl))
+	if misc.BClkSel || misc.BT8D != 1 {
+		t.Errorf("MiscControl = %+v, want the 1562500 bauds setting back", misc)
+	}
+	if got, err := c.ReadRegisterContext(context.Background(), 8, bm13xx.TicketMask); err != nil || got != 0xF0 {
+		t.Errorf("Chain.ReadRegisterContext() = 0x%08X, %v, want 0x000000F0", got, err)
+	}
+}
+
+func TestChain_switchBaudrate_noChip(t *testing.T) {
+	emu := New(bm13xx.BM1397, 0)
+	emu.SetSpeed(bm13xx.ResetBaudrate)
+	c := bm13xx.NewChain(emu, true, 25000000)
+	c.CommandTimeout = 50 * time.Millisecond
+	defer c.StopListening()
+	if _, err := c.SetBaudrate(1500000); !errors.Is(err, bm13xx.ErrInvalidState) {
+		t.Errorf("Chain.SetBaudrate() error = %v, want ErrInvalidState", err)
+	}
+	if _, err := c.Init(8); !errors.Is(err, bm13xx.ErrInvalidState) {
+		t.Errorf("Chain.Init() error = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestChain_ReadUnknownRegisters(t *testing.T) {
+	for _, model := range []*bm13xx.ChipModel{bm13xx.BM1397, bm13xx.BM1387} {
+		emu := New(model, 1)
+		c := bm13xx.NewChainForModel(emu, model, 25000000)
+		if _, err := c.Init(4); err != nil {
+			t.Fatal(err)
+		}
+		// only the models with a preamble answer them
+		if err := c.ReadUnknownRegisters(0); (err != nil) == model.Preamble {
+			t.Errorf("%v Chain.ReadUnknownRegisters() error = %v", model, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package emulator
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"hash"
+	"math/bits"
+	"time"
+
+	"github.com/GPTechinno/go-bm13xx"
+)
+
+const (
+	// nonce bits left free by the chip and core fields, scanned by every core
+	freeNonceBits = 19
+	// Nonce.Core() can only tell apart that many cores
+	maxNonceCores = 128
+	// how often a waiting Read lets the cores hash
+	hashTick = 10 * time.Millisecond
+	// hashes per core computed at once at most, so a late Read does not stall
+	maxHashBurst = 1000
+)
+
+// job is the work last sent to the chain, ready to be hashed.
+type job struct {
+	id        byte
+	midstates []bm13xx.Midstate
+	tail      []byte // merkle root tail, nTime and nBits, in header order
+	header    []byte // first 76 bytes of the header, full header jobs only
+	start     uint32 // free bits of the starting nonce
+	done      uint32 // nonces hashed so far by each core
+}
+
+// Midstate returns the SHA-256 state after the first 64 bytes of a block header,
+// in the byte order SendJob expects.
+func Midstate(header []byte) bm13xx.Midstate {
+	h := sha256.New()
+	h.Write(header[:64])
+	state, _ := h.(encoding.BinaryMarshaler).MarshalBinary()
+	var midstate bm13xx.Midstate
+	// state is "sha\x03" followed by the 8 words in big endian
+	for i := 0; i < 32; i++ {
+		midstate[i] = state[4+31-i]
+	}
+	return midstate
+}
+
+// parseJob reads a job frame, nil if malformed.
+func (e *Chain) parseJob(frame []byte) *job {
+	n := int(frame[3])
+	data := frame[4 : len(frame)-2]
+	j := &job{id: frame[2]}
+	var startingNonce uint32
+	switch e.model.JobFormat {
+	case bm13xx.MidstateJobFormat, bm13xx.BM1387JobFormat:
+		if n < 1 || len(data) != 16+32*n {
+			return nil
+		}
+		startingNonce = binary.LittleEndian.Uint32(data)
+		j.tail = make([]byte, 12)
+		if e.model.JobFormat == bm13xx.MidstateJobFormat {
+			// nBits, nTime, merkle root
+			copy(j.tail[8:], data[4:8])
+			copy(j.tail[4:], data[8:12])
+			copy(j.tail, data[12:16])
+		} else {
+			// merkle root, nTime, nBits
+			copy(j.tail, data[4:16])
+		}
+		for i := 0; i < n; i++ {
+			var m bm13xx.Midstate
+			copy(m[:], data[16+32*i:])
+			j.midstates = append(j.midstates, m)
+		}
+	case bm13xx.FullHeaderJobFormat:
+		if len(data) != 80 {
+			return nil
+		}
+		startingNonce = binary.LittleEndian.Uint32(data)
+		j.header = make([]byte, 0, 80)
+		j.header = append(j.header, data[76:80]...) // version
+		j.header = append(j.header, data[44:76]...) // previous block hash
+		j.header = append(j.header, data[12:44]...) // merkle root
+		j.header = append(j.header, data[8:12]...)  // nTime
+		j.header = append(j.header, data[4:8]...)   // nBits
+	}
+	j.start = freeBits(startingNonce)
+	return j
+}
+
+// freeBits extracts the nonce bits which are neither the chip nor the core fields.
+func freeBits(nonce uint32) uint32 {
+	return nonce>>31<<18 | (nonce>>8&0xffff)<<2 | nonce&0x03
+}
+
+// nonceOf builds the nonce a core scans for the given free bits.
+func nonceOf(core, chipAddr byte, free uint32) uint32 {
+	return (free>>18&1)<<31 | uint32(core&0x7f)<<24 | (free>>2&0xffff)<<8 | uint32(chipAddr&0xfc) | free&0x03
+}
+
+// hash lets every core scan the nonces due since the last call, at CoreHashrate.
+func (e *Chain) hash() {
+	now := time.Now()
+	elapsed := now.Sub(e.lastHash)
+	e.lastHash = now
+	if e.job == nil || e.CoreHashrate <= 0 {
+		return
+	}
+	e.credit += elapsed.Seconds() * e.CoreHashrate
+	n := int(e.credit)
+	e.credit -= float64(n)
+	if n > maxHashBurst {
+		n = maxHashBurst
+	}
+	cores := e.model.Cores
+	if cores > maxNonceCores {
+		cores = maxNonceCores
+	}
+	for ; n > 0 && e.job.done < 1<<freeNonceBits; n-- {
+		free := (e.job.start + e.job.done) & (1<<freeNonceBits - 1)
+		for _, c := range e.chips {
+			for core := 0; core < cores; core++ {
+				e.hashNonce(c, nonceOf(byte(core), c.addr, free))
+			}
+		}
+		e.job.done++
+	}
+}
+
+func (e *Chain) hashNonce(c *chip, nonce uint32) {
+	zeros := 32 + bits.OnesCount32(c.regs[e.model.Reg(bm13xx.TicketMask)])
+	var wire [4]byte
+	// the nonce is sent in the header byte order
+	binary.BigEndian.PutUint32(wire[:], nonce)
+	if e.job.header != nil {
+		h := sha256.New()
+		h.Write(e.job.header)
+		h.Write(wire[:])
+		e.stats.Hashes++
+		if meetsTarget(h.Sum(nil), zeros) {
+			e.sendNonce(nonce, 0)
+		}
+		return
+	}
+	for i, m := range e.job.midstates {
+		h := restore(m)
+		h.Write(e.job.tail)
+		h.Write(wire[:])
+		e.stats.Hashes++
+		if meetsTarget(h.Sum(nil), zeros) {
+			e.sendNonce(nonce, byte(i))
+		}
+	}
+}
+
+// restore returns a SHA-256 hash which already digested the first 64 bytes of
+// the header summarized by a midstate.
+func restore(m bm13xx.Midstate) hash.Hash {
+	state := make([]byte, 0, 108)
+	state = append(state, "sha\x03"...)
+	for i := 31; i >= 0; i-- {
+		state = append(state, m[i])
+	}
+	state = append(state, make([]byte, 64)...)
+	state = append(state, 0, 0, 0, 0, 0, 0, 0, 64)
+	h := sha256.New()
+	h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+	return h
+}
+
+// meetsTarget checks the double SHA-256 of the header, read as the little endian
+// number bitcoin compares with the target, starts with enough zero bits.
+func meetsTarget(first []byte, zeros int) bool {
+	second := sha256.Sum256(first)
+	return bits.LeadingZeros64(binary.LittleEndian.Uint64(second[24:])) >= zeros
+}
+
+// sendNonce queues a nonce response, laid out the way the host decodes it.
+func (e *Chain) sendNonce(nonce uint32, midstate byte) {
+	frame := make([]byte, 4, 9)
+	binary.BigEndian.PutUint32(frame, nonce)
+	switch e.model.JobFormat {
+	case bm13xx.MidstateJobFormat:
+		frame = append(frame, 0, e.job.id&0xfc|midstate&0x03)
+	case bm13xx.BM1387JobFormat:
+		frame = append(frame, 0, e.job.id)
+	case bm13xx.FullHeaderJobFormat:
+		// versions are not rolled, small core 0
+		frame = append(frame, 0, e.job.id<<1&0xf0, 0, 0)
+	}
+	e.stats.Nonces++
+	e.send(seal(append(frame, 0x80)))
+}
@@ -0,0 +1,78 @@
+package bm13xx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors of the communication with the chain, to be checked with errors.Is.
+var (
+	// A frame was dropped because of a bad crc, a line glitch
+	ErrCRC = errors.New("bad crc5")
+	// Bytes were dropped while looking for the preamble of the next frame
+	ErrPreamble = errors.New("bad preamble")
+	// The transport returned nothing while a frame was incomplete
+	ErrShortFrame = errors.New("uncomplete resp")
+	// No reply came within the command timeout
+	ErrTimeout = errors.New("timeout")
+	// No chip at this address, or no such register known
+	ErrNotFound = errors.New("not found")
+	// A chip, core, PLL or baudrate outside of what the chain offers
+	ErrOutOfRange = errors.New("out of range")
+	// A frame of another kind than awaited, see also UnexpectedResponseError
+	ErrUnexpected = errors.New("unexpected response")
+	// A job of another layout than the chain expects
+	ErrJobFormat = errors.New("wrong job format")
+	// Chips of another model than the chain, or of several models
+	ErrModel = errors.New("wrong chip model")
+	// A call not allowed in the current state of the chain, like listening
+	ErrInvalidState = errors.New("invalid state")
+	// A PLL did not report LOCKED after being set
+	ErrNotLocked = errors.New("not locked")
+)
+
+// UnexpectedResponseError is a register reply which is not the one awaited.
+type UnexpectedResponseError struct {
+	WantChipAddr byte
+	WantRegAddr  RegAddr
+	Got          RegisterReply
+}
+
+// Is makes an UnexpectedResponseError match ErrUnexpected.
+func (e *UnexpectedResponseError) Is(target error) bool {
+	return target == ErrUnexpected
+}
+
+func (e *UnexpectedResponseError) Error() string {
+	return fmt.Sprintf("unexpected reply 0x%08X from register 0x%02X of chip 0x%02X, want register 0x%02X of chip 0x%02X",
+		e.Got.Value, byte(e.Got.RegAddr), e.Got.ChipAddr, byte(e.WantRegAddr), e.WantChipAddr)
+}
+
+// WriteMismatch is a chip which did not keep a verified write.
+type WriteMismatch struct {
+	ChipAddr byte
+	Got      uint32 // value read back
+	Err      error  // the read back failed
+}
+
+// VerifyError lists the chips which did not keep a verified write.
+type VerifyError struct {
+	RegAddr    RegAddr
+	Want       uint32
+	Mask       uint32 // bits compared, the others being read-only, write-only or self-clearing
+	Mismatches []WriteMismatch
+}
+
+func (e *VerifyError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "register 0x%02X not verified on %d chip(s):", byte(e.RegAddr), len(e.Mismatches))
+	for _, m := range e.Mismatches {
+		if m.Err != nil {
+			fmt.Fprintf(&sb, " chip 0x%02X %v;", m.ChipAddr, m.Err)
+		} else {
+			fmt.Fprintf(&sb, " chip 0x%02X 0x%08X want 0x%08X (mask 0x%08X);", m.ChipAddr, m.Got, e.Want, e.Mask)
+		}
+	}
+	return strings.TrimSuffix(sb.String(), ";")
+}
@@ -11,9 +11,9 @@ import (
 
 func main() {
 	pCom := flag.String("c", "/dev/serial/by-id/usb-FTDI_TTL232RG-VREG1V8_FT62FVAA-if00-port0", "COM Port")
-	pBaud := flag.Int("b", 115200, "Baudrate")
 	flag.Parse()
-	p, err := term.Open(*pCom)
+	// the chips UART runs at ResetBaudrate until Init switches both sides
+	p, err := term.Open(*pCom, term.Speed(bm13xx.ResetBaudrate))
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -31,15 +31,13 @@ func main() {
 	time.Sleep(time.Second)
 	p.SetRTS(true)
 	time.Sleep(100 * time.Millisecond)
-	p.SetSpeed(*pBaud)
+	// a *term.Term is a bm13xx.Transport, the chain switches its speed itself
 	chain := bm13xx.NewChain(p, true, 25000000)
 	baud, err := chain.Init(8)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	time.Sleep(time.Second)
-	p.SetSpeed(baud)
-	time.Sleep(200 * time.Millisecond)
+	log.Printf("chain running at %d bauds", baud)
 
 	// Chip Core messing
 	// chain.ReadRegister(true, 0, bm13xx.CoreRegisterControl)
@@ -57,9 +55,13 @@ func main() {
 	time.Sleep(10 * time.Millisecond)
 	chain.WriteRegister(true, 0, bm13xx.Pll0Divider, 0x0F0F0F00)
 	time.Sleep(10 * time.Millisecond)
-	chain.WriteRegister(true, 0, bm13xx.PLL0Parameter, 0x40A00225) // 25MHz * 0x0A0 / 0x02 / 2 / 5 = 200MHz
-	time.Sleep(10 * time.Millisecond)
-	chain.WriteRegister(true, 0, bm13xx.PLL0Parameter, 0x40A00225)
+	if _, err := chain.SetFrequency(true, 0, 200); err != nil {
+		log.Println(err)
+	}
+	// tune a single chip
+	// if _, err := chain.SetChipFrequency(context.Background(), 0, 225); err != nil {
+	// 	log.Println(err)
+	// }
 	time.Sleep(10 * time.Millisecond)
 	chain.ReadRegister(true, 0, bm13xx.PLL0Parameter)
 	chain.GetResponse()
@@ -95,65 +97,11 @@ func main() {
 	time.Sleep(time.Second)
 
 	// test Resgiter Writability
-	// fmt.Println("INVERT ALL REGISTERS VALUES")
-	// fmt.Println("-------------------------------------")
-	// if len(chain.Asics) >= 1 {
-	// 	for regAddr, regVal := range chain.Asics[0].Regs {
-	// 		if regAddr == bm13xx.ClockOrderControl0 ||
-	// 			regAddr == bm13xx.HashCountingNumber ||
-	// 			regAddr == bm13xx.PLL0Parameter ||
-	// 			regAddr == bm13xx.PLL1Parameter ||
-	// 			regAddr == bm13xx.PLL2Parameter ||
-	// 			regAddr == bm13xx.PLL3Parameter ||
-	// 			regAddr == bm13xx.Pll0Divider ||
-	// 			regAddr == bm13xx.Pll1Divider ||
-	// 			regAddr == bm13xx.Pll2Divider ||
-	// 			regAddr == bm13xx.Pll3Divider ||
-	// 			regAddr == bm13xx.OrderedClockEnable ||
-	// 			regAddr == bm13xx.AnalogMuxControl ||
-	// 			regAddr == bm13xx.ChipNonceOffset ||
-	// 			regAddr == bm13xx.CoreRegisterControl ||
-	// 			regAddr == bm13xx.CoreRegisterValue ||
-	// 			regAddr == bm13xx.OrderedClockMonitor ||
-	// 			regAddr == bm13xx.ExternalTemperatureSensorRead ||
-	// 			regAddr == bm13xx.ChipAddress ||
-	// 			regAddr == bm13xx.NonceOverflowCounter ||
-	// 			regAddr == bm13xx.ErrorFlag ||
-	// 			regAddr == bm13xx.NonceErrorCounter ||
-	// 			regAddr == bm13xx.TicketMask2 ||
-	// 			regAddr == bm13xx.TicketMask ||
-	// 			regAddr == bm13xx.GoldenNonceForSweepReturn ||
-	// 			regAddr == bm13xx.SomeTempRelated ||
-	// 			regAddr == bm13xx.ClockOrderStatus ||
-	// 			regAddr == bm13xx.HashRate ||
-	// 			regAddr == bm13xx.MiscControl ||
-	// 			regAddr == bm13xx.ReturnedGroupPatternStatus ||
-	// 			regAddr == bm13xx.ReturnedSinglePatternStatus ||
-	// 			regAddr == bm13xx.IoDriverStrenghtConfiguration ||
-	// 			regAddr == bm13xx.TimeOut ||
-	// 			regAddr == bm13xx.FastUARTConfiguration ||
-	// 			regAddr == bm13xx.NonceReturnedTimeout ||
-	// 			regAddr == bm13xx.UARTRelay ||
-	// 			regAddr == bm13xx.FrequencySweepControl1 ||
-	// 			regAddr == bm13xx.ClockOrderControl1 {
-	// 			continue
-	// 		}
-	// 		bm13xx.DumpAsicReg(regAddr, regVal, true)
-	// 		inverter := uint32(0xffffffff)
-	// 		if regAddr == bm13xx.MiscControl {
-	// 			inverter = 0xffbfffff // avoid CORE_SRST
-	// 		}
-	// 		err := chain.WriteRegister(false, 0, regAddr, regVal^inverter)
-	// 		fmt.Printf("WriteRegister %02X: %08X err: %v\n", regAddr, regVal^inverter, err)
-	// 		err = chain.ReadRegister(true, 0, regAddr)
-	// 		if err == nil {
-	// 			regValue, chipAddr, regAddress, err := chain.GetResponse()
-	// 			fmt.Printf("ReadRegister %02X %02X: %08X err: %v\n", chipAddr, regAddress, regValue, err)
-	// 			bm13xx.DumpAsicReg(regAddr, regValue, true)
-	// 		}
-	// 		fmt.Println("-------------------------------------")
-	// 	}
+	// report, err := chain.Probe(context.Background(), 0, bm13xx.ProbeOptions{Writability: true})
+	// if err != nil {
+	// 	log.Println(err)
 	// }
+	// report.Fprint(os.Stdout)
 
 	// Test Chip Address
 	// fmt.Println("CHIP ADDRESS")
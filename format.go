@@ -0,0 +1,143 @@
+package bm13xx
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Field is a decoded bit field of a register value.
+type Field struct {
+	Name  string `json:"name"`
+	Bits  string `json:"bits"` // like "31:16" or "7"
+	Value uint32 `json:"value"`
+}
+
+// RegisterDump is a register value with its decoded fields.
+type RegisterDump struct {
+	Name   string  `json:"name"`
+	Addr   byte    `json:"addr"` // RegAddr, or CoreRegID for a core register
+	Core   bool    `json:"core,omitempty"`
+	Value  uint32  `json:"value"`
+	Fields []Field `json:"fields,omitempty"`
+}
+
+// DecodeAsicReg decodes a register value of a chip model, BM1397 layout if model is nil.
+func DecodeAsicReg(model *ChipModel, regAddr RegAddr, regVal uint32) RegisterDump {
+	d := RegisterDump{Addr: byte(regAddr), Value: regVal}
+	if r := model.schema().Register(model.name(), regAddr); r != nil {
+		d.Name, d.Fields = r.Name, r.Decode(regVal)
+	} else {
+		d.Name = fmt.Sprintf("Unknown Register 0x%02X", byte(regAddr))
+	}
+	return d
+}
+
+// DecodeCoreReg decodes a core register value of a chip model.
+func DecodeCoreReg(model *ChipModel, regID CoreRegID, regVal uint16) RegisterDump {
+	d := RegisterDump{Addr: byte(regID), Core: true, Value: uint32(regVal)}
+	if r := model.schema().CoreRegister(regID); r != nil {
+		d.Name, d.Fields = r.Name, r.Decode(uint32(regVal))
+	} else {
+		d.Name = fmt.Sprintf("Unknown Core Register %d", byte(regID))
+	}
+	return d
+}
+
+// Formatter renders the registers known of a chip.
+type Formatter interface {
+	Format(w io.Writer, chip Asic) error
+}
+
+// TextFormatter renders registers in the human format of DumpAsicReg.
+type TextFormatter struct {
+	Debug bool // also show reserved bits
+}
+
+// JSONFormatter renders a chip as a JSON object.
+type JSONFormatter struct {
+	Indent string // indentation of nested elements, compact if empty
+}
+
+// CSVFormatter renders a line per register field, with a header line.
+type CSVFormatter struct{}
+
+// Decode returns the known registers of a chip, in address order, followed by
+// its core registers.
+func (a Asic) Decode() []RegisterDump {
+	registers := allRegisters
+	if a.Model != nil && a.Model.Registers != nil {
+		registers = a.Model.Registers
+	}
+	var dumps []RegisterDump
+	for _, addr := range registers {
+		if val, exist := a.Regs[addr]; exist {
+			dumps = append(dumps, DecodeAsicReg(a.Model, addr, val))
+		}
+	}
+	for _, id := range allCoreRegisters {
+		if val, exist := a.CoreRegs[id]; exist {
+			dumps = append(dumps, DecodeCoreReg(a.Model, id, val))
+		}
+	}
+	return dumps
+}
+
+func (f TextFormatter) Format(w io.Writer, chip Asic) error {
+	ew := &errWriter{w: w}
+	var lastCoreRegID CoreRegID
+	for _, d := range chip.Decode() {
+		if d.Core {
+			fprintCoreReg(ew, chip.Model.schema(), CoreRegID(d.Addr), uint16(d.Value), f.Debug)
+		} else {
+			fprintReg(ew, chip.Model.schema(), chip.Model.name(), RegAddr(d.Addr), d.Value, f.Debug, &lastCoreRegID)
+		}
+	}
+	return ew.err
+}
+
+func (f JSONFormatter) Format(w io.Writer, chip Asic) error {
+	v := struct {
+		Model     string         `json:"model,omitempty"`
+		Registers []RegisterDump `json:"registers"`
+	}{Registers: chip.Decode()}
+	if chip.Model != nil {
+		v.Model = chip.Model.Name
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", f.Indent)
+	return enc.Encode(v)
+}
+
+func (f CSVFormatter) Format(w io.Writer, chip Asic) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"register", "addr", "core", "value", "field", "bits", "field_value"})
+	for _, d := range chip.Decode() {
+		reg := []string{d.Name, fmt.Sprintf("0x%02X", d.Addr), strconv.FormatBool(d.Core), fmt.Sprintf("0x%08X", d.Value)}
+		if len(d.Fields) == 0 {
+			cw.Write(append(reg, "", "", ""))
+		}
+		for _, field := range d.Fields {
+			cw.Write(append(reg[:4:4], field.Name, field.Bits, fmt.Sprintf("0x%X", field.Value)))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// errWriter keeps the first write error, the Fprint functions ignoring them.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	var n int
+	n, ew.err = ew.w.Write(p)
+	return n, ew.err
+}
@@ -0,0 +1,99 @@
+package bm13xx
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFormatter_Format(t *testing.T) {
+	chip := Asic{
+		Model:    BM1397,
+		Regs:     map[RegAddr]uint32{ChipAddress: 0x13971800, ErrorFlag: 0x01020003},
+		CoreRegs: map[CoreRegID]uint16{CoreEnable: 0x00ff},
+	}
+	tests := []struct {
+		name string
+		f    Formatter
+		want string
+	}{
+		{
+			name: "text",
+			f:    TextFormatter{},
+			want: `Chip Address : 0x13971800
+  BIT[31:16] CHIP_ID = 0x1397
+  BIT[15:8]  CORE_NUM = 0x18
+  BIT[7:0]   ADDR = 0x00
+Error Flag : 0x01020003
+  BIT[31:24] CMD_ERR_CNT = 0x01
+  BIT[23:16] WORK_ERR_CNT = 0x02
+  BIT[7:0]   CORE_RESP_ERR = 0x03
+  Core Enable : 0x00FF
+    BIT[7:0]   CORE_EN_I = 0xFF
+`,
+		},
+		{
+			name: "json",
+			f:    JSONFormatter{},
+			want: `{"model":"BM1397","registers":[` +
+				`{"name":"Chip Address","addr":0,"value":328669184,"fields":[{"name":"CHIP_ID","bits":"31:16","value":5015},{"name":"CORE_NUM","bits":"15:8","value":24},{"name":"ADDR","bits":"7:0","value":0}]},` +
+				`{"name":"Error Flag","addr":72,"value":16908291,"fields":[{"name":"CMD_ERR_CNT","bits":"31:24","value":1},{"name":"WORK_ERR_CNT","bits":"23:16","value":2},{"name":"CORE_RESP_ERR","bits":"7:0","value":3}]},` +
+				`{"name":"Core Enable","addr":4,"core":true,"value":255,"fields":[{"name":"CORE_EN_I","bits":"7:0","value":255}]}]}
+`,
+		},
+		{
+			name: "csv",
+			f:    CSVFormatter{},
+			want: `register,addr,core,value,field,bits,field_value
+Chip Address,0x00,false,0x13971800,CHIP_ID,31:16,0x1397
+Chip Address,0x00,false,0x13971800,CORE_NUM,15:8,0x18
+Chip Address,0x00,false,0x13971800,ADDR,7:0,0x0
+Error Flag,0x48,false,0x01020003,CMD_ERR_CNT,31:24,0x1
+Error Flag,0x48,false,0x01020003,WORK_ERR_CNT,23:16,0x2
+Error Flag,0x48,false,0x01020003,CORE_RESP_ERR,7:0,0x3
+Core Enable,0x04,true,0x000000FF,CORE_EN_I,7:0,0xFF
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tt.f.Format(&b, chip); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("Format() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextFormatter_coreRegisterValue(t *testing.T) {
+	// dumps of chips which last read different core registers, at once
+	ids := []CoreRegID{CoreEnable, CoreError}
+	outs := make([]bytes.Buffer, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		ctrl := CoreRegisterControlReg{CoreRegID: id}
+		chip := Asic{
+			Model: BM1397,
+			Regs:  map[RegAddr]uint32{CoreRegisterControl: ctrl.Encode(), CoreRegisterValue: 0x00FF},
+		}
+		wg.Add(1)
+		go func(b *bytes.Buffer) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				b.Reset()
+				TextFormatter{}.Format(b, chip)
+			}
+		}(&outs[i])
+	}
+	wg.Wait()
+	for i, id := range ids {
+		want := DefaultSchema.CoreRegister(id).Name + " : 0x00FF"
+		if got := outs[i].String(); strings.Count(got, want) != 1 {
+			t.Errorf("Format() =\n%s\nwant CoreRegisterValue as %q", got, want)
+		}
+	}
+}
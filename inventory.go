@@ -0,0 +1,23 @@
+package bm13xx
+
+// ChipInfo describes a chip of the chain.
+type ChipInfo struct {
+	Index   int     `json:"index"`
+	Addr    byte    `json:"addr"`
+	ChipID  uint16  `json:"chip_id"`
+	Model   string  `json:"model,omitempty"`
+	CoreNum byte    `json:"core_num"`
+	Freq    float64 `json:"freq"` // PLL0 frequency last set, MHz
+}
+
+// Inventory lists the chips of the chain in their order on it.
+func (c *Chain) Inventory() []ChipInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	inventory := make([]ChipInfo, len(c.Asics))
+	for i, a := range c.Asics {
+		inventory[i] = ChipInfo{Index: i, Addr: a.Addr(), ChipID: a.ChipID(), Model: a.Model.name(),
+			CoreNum: a.CoreNum(), Freq: a.Freq}
+	}
+	return inventory
+}
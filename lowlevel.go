@@ -18,6 +18,22 @@ const (
 	chainInactive cmd = 0x43
 )
 
+// BM1387 uses other command codes (and no preamble)
+var bm1387Cmds = map[cmd]byte{
+	sendJob:       0x21,
+	setChipAddr:   0x41,
+	writeRegister: 0x48,
+	readRegister:  0x44,
+	chainInactive: 0x45,
+}
+
+func (c *Chain) opcode(cmd cmd) byte {
+	if !c.is139x {
+		return bm1387Cmds[cmd]
+	}
+	return byte(cmd)
+}
+
 func crc5(data []byte) byte {
 	crc5 := crc.NewHash(&crc.Parameters{Width: 5, Polynomial: 0x05, Init: 0x1F, ReflectIn: false, ReflectOut: false, FinalXor: 0x00})
 	return byte(crc5.CalculateCRC(data))
@@ -29,7 +45,7 @@ func crc16(data []byte) uint16 {
 }
 
 func (c *Chain) sendCommand(cmd cmd, all bool, chipAddr byte, regAddr byte, data []byte) (int, error) {
-	frame := []byte{byte(cmd), 0, chipAddr, regAddr}
+	frame := []byte{c.opcode(cmd), 0, chipAddr, regAddr}
 	if all {
 		frame[0] += 0x10
 	}
@@ -46,6 +62,8 @@ func (c *Chain) sendCommand(cmd cmd, all bool, chipAddr byte, regAddr byte, data
 	if c.is139x {
 		frame = append([]byte{0x55, 0xAA}, frame...)
 	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
 	return c.port.Write(frame)
 }
 
@@ -55,10 +73,20 @@ func (c *Chain) SetChipAddr(chipAddr byte) error {
 	return err
 }
 
+// WriteRegister writes a register of one chip, or of every chip if all, and
+// updates the shadow of the registers (see Asic.State).
 func (c *Chain) WriteRegister(all bool, chipAddr byte, regAddr RegAddr, regVal uint32) error {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.writeRegister(all, chipAddr, regAddr, regVal)
+}
+
+// writeRegister is WriteRegister for the callers holding reqMu.
+func (c *Chain) writeRegister(all bool, chipAddr byte, regAddr RegAddr, regVal uint32) error {
 	data := make([]byte, 4)
 	binary.BigEndian.PutUint32(data, regVal)
 	_, err := c.sendCommand(writeRegister, all, chipAddr, byte(regAddr), data)
+	c.shadowWrite(all, chipAddr, regAddr, regVal, err != nil)
 	return err
 }
 
@@ -67,29 +95,121 @@ func (c *Chain) ReadRegister(all bool, chipAddr byte, regAddr RegAddr) error {
 	return err
 }
 
-func (c *Chain) GetResponse() (uint32, byte, byte, error) {
-	respLen := 7
-	if c.is139x {
-		respLen += 2
+// Set in the last byte (along with the CRC5) of frames answering a job
+const jobResponseFlag = 0x80
+
+// RegisterReply is the answer of a chip to a ReadRegister command.
+type RegisterReply struct {
+	Value    uint32
+	ChipAddr byte
+	RegAddr  RegAddr
+}
+
+// NonceReply is a nonce found by a chip on a job sent with SendJob or SendHeaderJob.
+type NonceReply struct {
+	Nonce    Nonce
+	Midstate byte
+	JobID    byte
+	// Only for FullHeaderJobFormat chips
+	SmallCore byte
+	Version   uint32 // rolled version bits, to be ORed with the job version
+}
+
+func (r NonceReply) Chip() byte {
+	return r.Nonce.Chip()
+}
+
+func (r NonceReply) Core() byte {
+	return r.Nonce.Core()
+}
+
+// Response is a frame received from the chain, exactly one of Register or Nonce is set.
+type Response struct {
+	Register *RegisterReply
+	Nonce    *NonceReply
+}
+
+func (c *Chain) readFrame() ([]byte, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	frame, err := c.dec.Next()
+	// the decoder counters are only readable by the goroutine reading
+	c.disp.mu.Lock()
+	c.disp.decStats = c.dec.Stats()
+	c.disp.mu.Unlock()
+	return frame, err
+}
+
+func decodeResponse(format JobFormat, resp []byte) Response {
+	if resp[len(resp)-1]&jobResponseFlag != 0 {
+		if format == FullHeaderJobFormat {
+			// job id is in the upper nibble, small core id in the lower one
+			return Response{Nonce: &NonceReply{
+				Nonce:     Nonce(binary.BigEndian.Uint32(resp)),
+				Midstate:  resp[4],
+				JobID:     (resp[5] & 0xf0) >> 1,
+				SmallCore: resp[5] & 0x0f,
+				Version:   uint32(binary.BigEndian.Uint16(resp[6:])) << 13,
+			}}
+		}
+		if format == BM1387JobFormat {
+			return Response{Nonce: &NonceReply{
+				Nonce: Nonce(binary.BigEndian.Uint32(resp)),
+				JobID: resp[5],
+			}}
+		}
+		// the 2 lowest bits of the job id byte are the midstate index
+		return Response{Nonce: &NonceReply{
+			Nonce:    Nonce(binary.BigEndian.Uint32(resp)),
+			Midstate: resp[5] & 0x03,
+			JobID:    resp[5] & 0xfc,
+		}}
+	}
+	return Response{Register: &RegisterReply{
+		Value:    binary.BigEndian.Uint32(resp),
+		ChipAddr: resp[4],
+		RegAddr:  RegAddr(resp[5]),
+	}}
+}
+
+// ReadResponse reads the next frame from the chain, either a register reply or a nonce.
+func (c *Chain) ReadResponse() (Response, error) {
+	if c.isListening() {
+		return Response{}, fmt.Errorf("reading while listening %w", ErrInvalidState)
 	}
-	resp := make([]byte, respLen)
-	i, err := c.port.Read(resp)
+	return c.readResponse()
+}
+
+func (c *Chain) readResponse() (Response, error) {
+	resp, err := c.readFrame()
 	if err != nil {
-		return 0, 0, 0, err
+		return Response{}, err
 	}
-	if i != respLen {
-		return 0, 0, 0, fmt.Errorf("uncomplete resp")
+	return decodeResponse(c.JobFormat(), resp), nil
+}
+
+// ReadNonce reads the next frame from the chain and fails if it is not a nonce.
+func (c *Chain) ReadNonce() (NonceReply, error) {
+	resp, err := c.ReadResponse()
+	if err != nil {
+		return NonceReply{}, err
 	}
-	if c.is139x {
-		if resp[0] != 0xAA || resp[1] != 0x55 {
-			return 0, 0, 0, fmt.Errorf("bad preamble")
-		}
-		resp = resp[2:]
+	if resp.Nonce == nil {
+		return NonceReply{}, fmt.Errorf("not a nonce %w", ErrUnexpected)
 	}
-	if crc5(resp) != 0x00 {
-		return 0, 0, 0, fmt.Errorf("bad crc5")
+	return *resp.Nonce, nil
+}
+
+// GetResponse reads the next frame from the chain and fails if it is not a register reply.
+func (c *Chain) GetResponse() (uint32, byte, byte, error) {
+	resp, err := c.ReadResponse()
+	if err != nil {
+		return 0, 0, 0, err
 	}
-	return binary.BigEndian.Uint32(resp), resp[4], resp[5], nil
+	if resp.Register == nil {
+		return 0, 0, 0, fmt.Errorf("not a register %w", ErrUnexpected)
+	}
+	return resp.Register.Value, resp.Register.ChipAddr, byte(resp.Register.RegAddr), nil
 }
 
 func (c *Chain) Inactive() error {
@@ -98,22 +218,100 @@ func (c *Chain) Inactive() error {
 	return err
 }
 
+// JobFormat is the layout of the jobs a chip model understands.
+type JobFormat byte
+
+const (
+	// Starting nonce, nBits, nTime, merkle root tail and up to 4 midstates (BM1397)
+	MidstateJobFormat JobFormat = iota
+	// Full block header fields, the chip rolls the version itself (BM1366, BM1368, BM1370)
+	FullHeaderJobFormat
+	// Starting nonce, merkle root tail, nTime, nBits and a single midstate (BM1387)
+	BM1387JobFormat
+)
+
+// Length of the response frames (preamble excluded) sent back by chips using this job format
+func (f JobFormat) respLen() int {
+	if f == FullHeaderJobFormat {
+		return 9
+	}
+	return 7
+}
+
+// SetJobFormat selects the layout of the jobs, and of the nonces sent back.
+func (c *Chain) SetJobFormat(format JobFormat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jobFormat = format
+	c.dec.SetFrameLen(format.respLen())
+}
+
+// JobFormat returns the layout of the jobs the chain expects.
+func (c *Chain) JobFormat() JobFormat {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.jobFormat
+}
+
 type Midstate [32]byte
 
 func (c *Chain) SendJob(jobID byte, startingNonce uint32, nBits uint32, nTime uint32, merkelRoot uint32, midstates []Midstate) error {
+	var fields []uint32
+	switch c.JobFormat() {
+	case MidstateJobFormat:
+		fields = []uint32{startingNonce, nBits, nTime, merkelRoot}
+	case BM1387JobFormat:
+		if len(midstates) != 1 {
+			return fmt.Errorf("BM1387 takes a single midstate %w", ErrJobFormat)
+		}
+		fields = []uint32{startingNonce, merkelRoot, nTime, nBits}
+	default:
+		return fmt.Errorf("midstate job %w", ErrJobFormat)
+	}
 	var data []byte
 	value := make([]byte, 4)
-	binary.LittleEndian.PutUint32(value, startingNonce)
-	data = append(data, value...)
-	binary.LittleEndian.PutUint32(value, nBits)
-	data = append(data, value...)
-	binary.LittleEndian.PutUint32(value, nTime)
-	data = append(data, value...)
-	binary.LittleEndian.PutUint32(value, merkelRoot)
-	data = append(data, value...)
+	for _, field := range fields {
+		binary.LittleEndian.PutUint32(value, field)
+		data = append(data, value...)
+	}
 	for _, midstate := range midstates {
 		data = append(data, midstate[:]...)
 	}
 	_, err := c.sendCommand(sendJob, false, jobID, byte(len(midstates)), data)
 	return err
 }
+
+// HeaderJob is a job for the chips rolling the version themselves,
+// hashes are given in the block header byte order.
+type HeaderJob struct {
+	JobID         byte
+	StartingNonce uint32
+	NBits         uint32
+	NTime         uint32
+	MerkleRoot    [32]byte
+	PrevBlockHash [32]byte
+	Version       uint32
+}
+
+func (c *Chain) SendHeaderJob(job HeaderJob) error {
+	if c.JobFormat() != FullHeaderJobFormat {
+		return fmt.Errorf("header job %w", ErrJobFormat)
+	}
+	data := make([]byte, 12, 80)
+	binary.LittleEndian.PutUint32(data, job.StartingNonce)
+	binary.LittleEndian.PutUint32(data[4:], job.NBits)
+	binary.LittleEndian.PutUint32(data[8:], job.NTime)
+	data = append(data, job.MerkleRoot[:]...)
+	data = append(data, job.PrevBlockHash[:]...)
+	value := make([]byte, 4)
+	binary.LittleEndian.PutUint32(value, job.Version)
+	data = append(data, value...)
+	// Always a single midstate, the chip computes it from the header
+	_, err := c.sendCommand(sendJob, false, job.JobID, 1, data)
+	return err
+}
+
+// SetVersionMask tells every chip which version bits it is allowed to roll.
+func (c *Chain) SetVersionMask(mask uint32) error {
+	return c.WriteRegister(true, 0, VersionRolling, 0x90000000|(mask>>13)&0xffff)
+}
@@ -2,6 +2,7 @@ package bm13xx
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -140,6 +141,15 @@ func TestChain_SetChipAddr(t *testing.T) {
 			wantErr: false,
 			wantBuf: []byte{0x55, 0xAA, 0x40, 0x05, 0x08, 0x00, 0x07},
 		},
+		{
+			name:   "BM1387 chipAddr 8",
+			is139x: false,
+			args: args{
+				chipAddr: 8,
+			},
+			wantErr: false,
+			wantBuf: []byte{0x41, 0x05, 0x08, 0x00, 0x0E},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -206,6 +216,18 @@ func TestChain_WriteRegister(t *testing.T) {
 			wantErr: false,
 			wantBuf: []byte{0x55, 0xAA, 0x51, 0x09, 0x00, 0x14, 0x00, 0x00, 0x00, 0xFC, 0x07},
 		},
+		{
+			name:   "BM1387 all Misc Control = 0x40201A00",
+			is139x: false,
+			args: args{
+				all:      true,
+				chipAddr: 0,
+				regAddr:  BM1387MiscControl,
+				regVal:   0x40201A00,
+			},
+			wantErr: false,
+			wantBuf: []byte{0x58, 0x09, 0x00, 0x1C, 0x40, 0x20, 0x1A, 0x00, 0x02},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -246,6 +268,17 @@ func TestChain_ReadRegister(t *testing.T) {
 			wantErr: false,
 			wantBuf: []byte{0x55, 0xAA, 0x52, 0x05, 0x00, 0x00, 0x0A},
 		},
+		{
+			name:   "BM1387 all Chip Address",
+			is139x: false,
+			args: args{
+				all:      true,
+				chipAddr: 0,
+				regAddr:  BM1387ChipAddress,
+			},
+			wantErr: false,
+			wantBuf: []byte{0x54, 0x05, 0x00, 0x00, 0x19},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -284,9 +317,9 @@ func TestChain_SendJob(t *testing.T) {
 			args: args{
 				jobID:         0,
 				startingNonce: 0x00000000,
-				nBits:         0x159E0717,
-				nTime:         0x75328E63,
-				merkelRoot:    0xA2B36A70,
+				nBits:         0x17079E15,
+				nTime:         0x638E3275,
+				merkelRoot:    0x706AB3A2,
 				midstates: []Midstate{
 					{0xDE, 0x60, 0x4A, 0x09, 0xE9, 0x30, 0x1D, 0xE1, 0x25, 0x6D, 0x7E, 0xB8, 0x0E, 0xA1, 0xE6, 0x43, 0x82, 0xDF, 0x61, 0x14, 0x15, 0x03, 0x96, 0x6C, 0x18, 0x5F, 0x50, 0x2F, 0x55, 0x74, 0xD4, 0xBA},
 					{0xAE, 0x2F, 0x3F, 0xC6, 0x02, 0xD9, 0xCD, 0x3B, 0x9E, 0x39, 0xAD, 0x97, 0x9C, 0xFD, 0xFF, 0x3A, 0x40, 0x49, 0x4D, 0xB6, 0xD7, 0x8D, 0xA4, 0x51, 0x34, 0x99, 0x29, 0xD1, 0xAD, 0x36, 0x66, 0x1D},
@@ -303,6 +336,34 @@ func TestChain_SendJob(t *testing.T) {
 				0xAD, 0x62, 0x59, 0x3A, 0x8D, 0xA3, 0x28, 0xAF, 0xEC, 0x09, 0x6D, 0x86, 0xB9, 0x8E, 0x30, 0xE5, 0x79, 0xAE, 0xA4, 0x35, 0xE1, 0x4B, 0xB5, 0xD7, 0x09, 0xCC, 0xE1, 0x74, 0x04, 0x3A, 0x7C, 0x2D,
 				0x1B, 0x5C},
 		},
+		{
+			name:   "BM1387 Job 2",
+			is139x: false,
+			args: args{
+				jobID:         2,
+				startingNonce: 0x00000000,
+				nBits:         0x17079E15,
+				nTime:         0x638E3275,
+				merkelRoot:    0x995F3ED7,
+				midstates: []Midstate{
+					{0x03, 0x53, 0x4B, 0x27, 0xC1, 0xBD, 0xF5, 0x47, 0x07, 0xCA, 0xD9, 0x13, 0xB9, 0x69, 0x07, 0x01, 0x57, 0xC7, 0xFC, 0xDB, 0x48, 0xE3, 0xE0, 0xAB, 0x48, 0x7C, 0xE3, 0xA7, 0xDD, 0xFA, 0x2F, 0xA0},
+				},
+			},
+			wantErr: false,
+			wantBuf: []byte{
+				0x21, 0x36, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00, 0xD7, 0x3E, 0x5F, 0x99, 0x75, 0x32, 0x8E, 0x63, 0x15, 0x9E, 0x07, 0x17,
+				0x03, 0x53, 0x4B, 0x27, 0xC1, 0xBD, 0xF5, 0x47, 0x07, 0xCA, 0xD9, 0x13, 0xB9, 0x69, 0x07, 0x01, 0x57, 0xC7, 0xFC, 0xDB, 0x48, 0xE3, 0xE0, 0xAB, 0x48, 0x7C, 0xE3, 0xA7, 0xDD, 0xFA, 0x2F, 0xA0,
+				0x51, 0x61},
+		},
+		{
+			name:   "BM1387 Job with 2 midstates",
+			is139x: false,
+			args: args{
+				jobID:     2,
+				midstates: []Midstate{{}, {}},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -316,3 +377,161 @@ func TestChain_SendJob(t *testing.T) {
 		})
 	}
 }
+
+func TestChain_SendHeaderJob(t *testing.T) {
+	job := HeaderJob{JobID: 0x18, StartingNonce: 0, NBits: 0x17034219, NTime: 0x64D1CCE1, Version: 0x20000004}
+	for i := range job.MerkleRoot {
+		job.MerkleRoot[i] = byte(i)
+		job.PrevBlockHash[i] = byte(0xff - i)
+	}
+	tests := []struct {
+		name    string
+		c       *Chain
+		format  JobFormat
+		job     HeaderJob
+		wantErr bool
+		buf     bytes.Buffer
+		wantBuf []byte
+	}{
+		{
+			name:   "Job 0x18",
+			format: FullHeaderJobFormat,
+			job:    job,
+			wantBuf: []byte{
+				0x55, 0xAA, 0x21, 0x56, 0x18, 0x01, 0x00, 0x00, 0x00, 0x00, 0x19, 0x42, 0x03, 0x17, 0xE1, 0xCC, 0xD1, 0x64,
+				0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F,
+				0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E, 0x1F,
+				0xFF, 0xFE, 0xFD, 0xFC, 0xFB, 0xFA, 0xF9, 0xF8, 0xF7, 0xF6, 0xF5, 0xF4, 0xF3, 0xF2, 0xF1, 0xF0,
+				0xEF, 0xEE, 0xED, 0xEC, 0xEB, 0xEA, 0xE9, 0xE8, 0xE7, 0xE6, 0xE5, 0xE4, 0xE3, 0xE2, 0xE1, 0xE0,
+				0x04, 0x00, 0x00, 0x20,
+				0x01, 0x72},
+		},
+		{
+			name:    "wrong job format",
+			format:  MidstateJobFormat,
+			job:     job,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.c = NewChain(&tt.buf, true, 25000000)
+			tt.c.SetJobFormat(tt.format)
+			if err := tt.c.SendHeaderJob(tt.job); (err != nil) != tt.wantErr {
+				t.Errorf("Chain.SendHeaderJob() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !cmp.Equal(tt.buf.Bytes(), tt.wantBuf) {
+				t.Errorf("Chain.SendHeaderJob() buf = %v, wantBuf %v", tt.buf.Bytes(), tt.wantBuf)
+			}
+		})
+	}
+}
+
+func TestChain_ReadResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       *Chain
+		is139x  bool
+		format  JobFormat
+		buf     []byte
+		want    Response
+		wantErr bool
+	}{
+		{
+			name:   "register MiscControl",
+			is139x: true,
+			buf:    []byte{0xAA, 0x55, 0x00, 0x00, 0x61, 0x31, 0x00, 0x18, 0x04},
+			want:   Response{Register: &RegisterReply{Value: 0x00006131, ChipAddr: 0, RegAddr: MiscControl}},
+		},
+		{
+			name:   "nonce job 0x30 midstate 2",
+			is139x: true,
+			buf:    []byte{0xAA, 0x55, 0x7C, 0x2B, 0xAC, 0x1D, 0x00, 0x32, 0x97},
+			want:   Response{Nonce: &NonceReply{Nonce: 0x7C2BAC1D, Midstate: 2, JobID: 0x30}},
+		},
+		{
+			name:    "bad crc5",
+			is139x:  true,
+			buf:     []byte{0xAA, 0x55, 0x7C, 0x2B, 0xAC, 0x1D, 0x00, 0x32, 0x17},
+			wantErr: true,
+		},
+		{
+			name:   "full header nonce job 0x18 version rolled",
+			is139x: true,
+			format: FullHeaderJobFormat,
+			buf:    []byte{0xAA, 0x55, 0x12, 0x34, 0x56, 0x78, 0x00, 0x1A, 0x01, 0x20, 0x8B},
+			want:   Response{Nonce: &NonceReply{Nonce: 0x12345678, Midstate: 0, JobID: 0x08, SmallCore: 0x0A, Version: 0x00240000}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.c = NewChain(bytes.NewBuffer(tt.buf), tt.is139x, 25000000)
+			tt.c.SetJobFormat(tt.format)
+			got, err := tt.c.ReadResponse()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Chain.ReadResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("Chain.ReadResponse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNonceReply_Chip_Core(t *testing.T) {
+	r := NonceReply{Nonce: 0x7C2BAC1D}
+	if r.Chip() != 7 || r.Core() != 0x7C {
+		t.Errorf("NonceReply chip = %d core = %d, want 7 124", r.Chip(), r.Core())
+	}
+}
+
+func TestChain_errors(t *testing.T) {
+	nonce := []byte{0xAA, 0x55, 0x7C, 0x2B, 0xAC, 0x1D, 0x00, 0x32, 0x97}
+	tests := []struct {
+		name    string
+		call    func(c *Chain) error
+		wantErr error
+	}{
+		{
+			name: "nonce instead of a register",
+			call: func(c *Chain) error {
+				_, _, _, err := c.GetResponse()
+				return err
+			},
+			wantErr: ErrUnexpected,
+		},
+		{
+			name: "garbage before a frame",
+			call: func(c *Chain) error {
+				c.port.(*bytes.Buffer).Reset()
+				c.port.(*bytes.Buffer).Write(append([]byte{0x12}, nonce...))
+				_, err := c.ReadResponse()
+				return err
+			},
+			wantErr: ErrPreamble,
+		},
+		{
+			name: "header job on a midstate chain",
+			call: func(c *Chain) error {
+				return c.SendHeaderJob(HeaderJob{})
+			},
+			wantErr: ErrJobFormat,
+		},
+		{
+			name: "zero increment",
+			call: func(c *Chain) error {
+				_, err := c.Init(0)
+				return err
+			},
+			wantErr: ErrOutOfRange,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChain(bytes.NewBuffer(nonce), true, 25000000)
+			if err := tt.call(c); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
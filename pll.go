@@ -0,0 +1,185 @@
+package bm13xx
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// PLLLimits bounds the dividers of a PLL, whose VCO runs at clki * FBDIV / REFDIV
+// and output at VCO / (POSTDIV1 * POSTDIV2).
+type PLLLimits struct {
+	MinVCO, MaxVCO float64 // MHz
+	MaxFBDiv       uint16
+	MaxRefDiv      byte
+}
+
+// DefaultPLLLimits are the limits of the PLL0 of the BM1397 and later chips.
+var DefaultPLLLimits = PLLLimits{MinVCO: 2000, MaxVCO: 3200, MaxFBDiv: 0xfff, MaxRefDiv: 2}
+
+const maxPostDiv = 7
+
+// PLLSetting is a PLL divider setting and the frequency it gives.
+type PLLSetting struct {
+	FBDiv    uint16
+	RefDiv   byte
+	PostDiv1 byte
+	PostDiv2 byte
+	Freq     float64 // MHz
+}
+
+func (m *ChipModel) pllLimits() PLLLimits {
+	if m == nil || m.PLL == (PLLLimits{}) {
+		return DefaultPLLLimits
+	}
+	return m.PLL
+}
+
+// SolvePLL returns the divider setting whose frequency is the closest to target MHz
+// with a clki Hz reference clock, POSTDIV1 being kept greater or equal to POSTDIV2.
+func (m *ChipModel) SolvePLL(clki uint32, target float64) (PLLSetting, error) {
+	limits := m.pllLimits()
+	if target < limits.MinVCO/(maxPostDiv*maxPostDiv) || target > limits.MaxVCO {
+		return PLLSetting{}, fmt.Errorf("frequency %.2f MHz %w", target, ErrOutOfRange)
+	}
+	clk := float64(clki) / 1e6
+	var best PLLSetting
+	bestErr := math.Inf(1)
+	for refDiv := 1; refDiv <= int(limits.MaxRefDiv); refDiv++ {
+		for postDiv1 := maxPostDiv; postDiv1 >= 1; postDiv1-- {
+			for postDiv2 := postDiv1; postDiv2 >= 1; postDiv2-- {
+				divide := float64(refDiv * postDiv1 * postDiv2)
+				fbDiv := math.Round(target * divide / clk)
+				if fbDiv < 1 || fbDiv > float64(limits.MaxFBDiv) {
+					continue
+				}
+				if vco := clk * fbDiv / float64(refDiv); vco < limits.MinVCO || vco > limits.MaxVCO {
+					continue
+				}
+				freq := clk * fbDiv / divide
+				if err := math.Abs(freq - target); err < bestErr {
+					bestErr = err
+					best = PLLSetting{FBDiv: uint16(fbDiv), RefDiv: byte(refDiv),
+						PostDiv1: byte(postDiv1), PostDiv2: byte(postDiv2), Freq: freq}
+				}
+			}
+		}
+	}
+	if math.IsInf(bestErr, 1) {
+		return PLLSetting{}, fmt.Errorf("frequency %.2f MHz %w", target, ErrOutOfRange)
+	}
+	return best, nil
+}
+
+// Encode returns the PLL parameter value of the setting, enabled on the models
+// having a PLLEN bit.
+func (s PLLSetting) Encode(m *ChipModel) uint32 {
+	pll := PLLParameterReg{FBDiv: s.FBDiv, RefDiv: s.RefDiv, PostDiv1: s.PostDiv1, PostDiv2: s.PostDiv2}
+	pll.PLLEn = m == nil || m.PLLEnableBits
+	return pll.Encode()
+}
+
+// Time given to a PLL to lock on a new setting before reading it back
+const pllLockDwell = 100 * time.Millisecond
+
+// SetFrequency sets PLL0 of one chip, or of every chip if all, to the frequency
+// the closest to target MHz, and returns that frequency. See SetChipFrequency
+// to also check the chip got it.
+func (c *Chain) SetFrequency(all bool, chipAddr byte, target float64) (float64, error) {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	freq, err := c.writeFrequency(all, chipAddr, target)
+	if err != nil {
+		return 0, err
+	}
+	c.setFreq(all, chipAddr, freq)
+	return freq, nil
+}
+
+// writeFrequency writes PLL0 without recording the frequency in Asics, for the
+// callers checking the PLL locked first.
+func (c *Chain) writeFrequency(all bool, chipAddr byte, target float64) (float64, error) {
+	model := c.Model()
+	s, err := model.SolvePLL(c.clk, target)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.writeRegister(all, chipAddr, c.pll0Addr(), s.Encode(model)); err != nil {
+		return 0, err
+	}
+	return s.Freq, nil
+}
+
+func (c *Chain) setFreq(all bool, chipAddr byte, freq float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.Asics {
+		if all || c.Asics[i].Addr() == chipAddr {
+			c.Asics[i].Freq = freq
+		}
+	}
+}
+
+func (c *Chain) pll0Addr() RegAddr {
+	if model := c.Model(); model != nil {
+		return model.Reg(PLL0Parameter)
+	}
+	return PLL0Parameter
+}
+
+// SetChipFrequency sets PLL0 of a single chip to the frequency the closest to
+// target MHz, then reads it back after pllLockDwell, ErrNotLocked if the PLL did
+// not lock on it. Asic.Freq is only updated once it did.
+func (c *Chain) SetChipFrequency(ctx context.Context, chipIndex int, target float64) (float64, error) {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	if chipIndex >= len(c.Asics) || chipIndex < 0 {
+		return 0, fmt.Errorf("chipIndex %d %w", chipIndex, ErrOutOfRange)
+	}
+	chipAddr := c.Asics[chipIndex].Addr()
+	freq, err := c.writeFrequency(false, chipAddr, target)
+	if err != nil {
+		return 0, err
+	}
+	if err := sleep(ctx, pllLockDwell); err != nil {
+		return 0, err
+	}
+	got, err := c.readFrequency(ctx, chipIndex)
+	if err != nil {
+		return 0, err
+	}
+	if math.Abs(got-freq) > 1e-6 {
+		return got, fmt.Errorf("chip 0x%02X PLL0 at %.2f MHz instead of %.2f MHz %w",
+			chipAddr, got, freq, ErrNotLocked)
+	}
+	c.setFreq(false, chipAddr, freq)
+	return freq, nil
+}
+
+// ChipFrequency reads PLL0 of a chip and returns its frequency in MHz, 0 if
+// the PLL is off or not locked.
+func (c *Chain) ChipFrequency(ctx context.Context, chipIndex int) (float64, error) {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	if chipIndex >= len(c.Asics) || chipIndex < 0 {
+		return 0, fmt.Errorf("chipIndex %d %w", chipIndex, ErrOutOfRange)
+	}
+	return c.readFrequency(ctx, chipIndex)
+}
+
+func (c *Chain) readFrequency(ctx context.Context, chipIndex int) (float64, error) {
+	pllAddr := c.pll0Addr()
+	regVal, err := c.readRegister(ctx, c.Asics[chipIndex].Addr(), pllAddr)
+	if err != nil {
+		return 0, err
+	}
+	c.setReg(chipIndex, pllAddr, regVal)
+	hz, err := c.Asics[chipIndex].PllFreq(0, c.clk)
+	if err != nil {
+		return 0, err
+	}
+	return float64(hz) / 1e6, nil
+}
@@ -0,0 +1,48 @@
+package bm13xx
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestChipModel_SolvePLL(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    *ChipModel
+		target   float64
+		wantFreq float64
+		wantErr  error
+	}{
+		{name: "BM1397 200MHz", model: BM1397, target: 200, wantFreq: 200},
+		{name: "BM1366 485MHz", model: BM1366, target: 485, wantFreq: 485},
+		{name: "BM1397 closest", model: BM1397, target: 333.3, wantFreq: 1000.0 / 3},
+		{name: "BM1387 650MHz", model: BM1387, target: 650, wantFreq: 650},
+		{name: "too fast", model: BM1397, target: 5000, wantErr: ErrOutOfRange},
+		{name: "too slow", model: BM1397, target: 10, wantErr: ErrOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.model.SolvePLL(25000000, tt.target)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ChipModel.SolvePLL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if math.Abs(got.Freq-tt.wantFreq) > 1e-9 {
+				t.Errorf("ChipModel.SolvePLL() = %+v, want %v MHz", got, tt.wantFreq)
+			}
+			limits := tt.model.pllLimits()
+			vco := 25 * float64(got.FBDiv) / float64(got.RefDiv)
+			if vco < limits.MinVCO || vco > limits.MaxVCO || got.PostDiv1 < got.PostDiv2 {
+				t.Errorf("ChipModel.SolvePLL() = %+v, VCO %v MHz out of limits", got, vco)
+			}
+			// decoded back the same
+			a := Asic{Model: tt.model, Regs: map[RegAddr]uint32{tt.model.Reg(PLL0Parameter): got.Encode(tt.model) | 1<<31}}
+			if freq, err := a.PllFreq(0, 25000000); err != nil || freq != uint32(got.Freq*1e6) {
+				t.Errorf("Asic.PllFreq() = %d, %v, want %d", freq, err, uint32(got.Freq*1e6))
+			}
+		})
+	}
+}
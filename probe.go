@@ -0,0 +1,184 @@
+package bm13xx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// probeProtected are the bits probing never toggles, as they reset the chip,
+// change its clocks or the line speed, or reach beyond its registers.
+var probeProtected = map[RegAddr]uint32{
+	ChipAddress:                   0xffffffff,
+	PLL0Parameter:                 0xffffffff,
+	PLL1Parameter:                 0xffffffff,
+	PLL2Parameter:                 0xffffffff,
+	PLL3Parameter:                 0xffffffff,
+	Pll0Divider:                   0xffffffff,
+	Pll1Divider:                   0xffffffff,
+	Pll2Divider:                   0xffffffff,
+	Pll3Divider:                   0xffffffff,
+	MiscControl:                   0x0F4F3F00, // BT8D, CORE_SRST, clock selects and INV_CLKO
+	I2CControl:                    0xffffffff,
+	OrderedClockEnable:            0xffffffff,
+	FastUARTConfiguration:         0xffffffff,
+	UARTRelay:                     0xffffffff,
+	CoreRegisterControl:           0xffffffff,
+	IoDriverStrenghtConfiguration: 0xffffffff,
+	ClockOrderControl0:            0xffffffff,
+	ClockOrderControl1:            0xffffffff,
+	FrequencySweepControl1:        0xffffffff,
+}
+
+var bm1387ProbeProtected = map[RegAddr]uint32{
+	BM1387ChipAddress:  0xffffffff,
+	BM1387PLLParameter: 0xffffffff,
+	BM1387MiscControl:  0xffffffff,
+	BM1387I2CCommand:   0xffffffff,
+}
+
+// ProbeOptions tells how far Probe goes.
+type ProbeOptions struct {
+	// Toggle the bits of the answering registers to find the writable ones,
+	// each register being restored right after.
+	Writability bool
+	// Also toggle the registers the schema does not know, whose bits may as
+	// well reset the chip or change its clocks. Protect can spare some of them.
+	Unknown bool
+	// Bits not to toggle on top of the dangerous ones, by register.
+	Protect map[RegAddr]uint32
+}
+
+// ProbedRegister is an address which answered a probe.
+type ProbedRegister struct {
+	Addr     RegAddr `json:"addr"`
+	Value    uint32  `json:"value"`              // as first read
+	Volatile uint32  `json:"volatile,omitempty"` // bits which changed between two reads
+	Toggled  uint32  `json:"toggled,omitempty"`  // bits written inverted
+	Writable uint32  `json:"writable,omitempty"` // toggled bits read back inverted
+	Restored bool    `json:"restored"`           // value read back after restoring, true if untouched
+	Known    bool    `json:"known"`              // in the schema of the chip model
+}
+
+// ProbeReport lists the registers found on a chip.
+type ProbeReport struct {
+	ChipAddr  byte             `json:"chip_addr"`
+	Model     string           `json:"model,omitempty"`
+	Registers []ProbedRegister `json:"registers"`
+}
+
+// Probe reads every register address of a chip, 0x00 to 0xFC, and records the
+// ones answering. With opts.Writability it also writes them to find their writable bits.
+func (c *Chain) Probe(ctx context.Context, chipIndex int, opts ProbeOptions) (*ProbeReport, error) {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	if chipIndex >= len(c.Asics) || chipIndex < 0 {
+		return nil, fmt.Errorf("chipIndex %d %w", chipIndex, ErrOutOfRange)
+	}
+	chipAddr := c.Asics[chipIndex].Addr()
+	model := c.Model()
+	report := &ProbeReport{ChipAddr: chipAddr, Model: model.name()}
+	protected := probeProtected
+	if model == BM1387 {
+		protected = bm1387ProbeProtected
+	}
+	for addr := 0; addr <= 0xFC; addr += 4 {
+		regAddr := RegAddr(addr)
+		regVal, err := c.probeRead(ctx, chipAddr, regAddr)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		again, err := c.probeRead(ctx, chipAddr, regAddr)
+		if err != nil {
+			return report, err
+		}
+		c.setReg(chipIndex, regAddr, again)
+		reg := ProbedRegister{
+			Addr:     regAddr,
+			Value:    regVal,
+			Volatile: regVal ^ again,
+			Restored: true,
+			Known:    model.schema().Register(model.name(), regAddr) != nil,
+		}
+		if opts.Writability && (reg.Known || opts.Unknown) {
+			reg.Toggled = ^(protected[regAddr] | opts.Protect[regAddr] | reg.Volatile)
+		}
+		if reg.Toggled != 0 {
+			if err := c.toggle(ctx, chipIndex, chipAddr, &reg, again); err != nil {
+				return report, err
+			}
+		}
+		report.Registers = append(report.Registers, reg)
+	}
+	return report, nil
+}
+
+// probeRead reads a register, ErrNotFound if the chip does not answer, or only
+// with a truncated frame.
+func (c *Chain) probeRead(ctx context.Context, chipAddr byte, regAddr RegAddr) (uint32, error) {
+	regVal, err := c.readRegister(ctx, chipAddr, regAddr)
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrShortFrame) || errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("register 0x%02X %w", byte(regAddr), ErrNotFound)
+	}
+	return regVal, err
+}
+
+// toggle writes the register with its toggled bits inverted, reads it back and
+// writes the original value again.
+func (c *Chain) toggle(ctx context.Context, chipIndex int, chipAddr byte, reg *ProbedRegister, regVal uint32) error {
+	if err := c.writeRegister(false, chipAddr, reg.Addr, regVal^reg.Toggled); err != nil {
+		return err
+	}
+	got, err := c.readRegister(ctx, chipAddr, reg.Addr)
+	if err != nil {
+		return err
+	}
+	reg.Writable = (got ^ regVal) & reg.Toggled
+	if err := c.writeRegister(false, chipAddr, reg.Addr, regVal); err != nil {
+		return err
+	}
+	got, err = c.readRegister(ctx, chipAddr, reg.Addr)
+	if err != nil {
+		return err
+	}
+	c.setReg(chipIndex, reg.Addr, got)
+	reg.Restored = got&^reg.Volatile == regVal&^reg.Volatile
+	return nil
+}
+
+// Schema returns a draft layout of the registers the chip model schema misses,
+// to extend it with.
+func (r *ProbeReport) Schema() *Schema {
+	s := &Schema{}
+	for _, reg := range r.Registers {
+		if reg.Known {
+			continue
+		}
+		access := ReadOnly
+		if reg.Writable != 0 {
+			access = ReadWrite
+		}
+		rs := RegisterSchema{Name: fmt.Sprintf("Register 0x%02X", byte(reg.Addr)), Addr: reg.Addr,
+			Access: access, Reset: reg.Value}
+		if r.Model != "" {
+			rs.Models = []string{r.Model}
+		}
+		s.Registers = append(s.Registers, rs)
+	}
+	return s
+}
+
+// Fprint writes the report as a table to w.
+func (r *ProbeReport) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "Chip 0x%02X %s : %d registers\n", r.ChipAddr, r.Model, len(r.Registers))
+	fmt.Fprintf(w, "  ADDR VALUE      VOLATILE   TOGGLED    WRITABLE   RESTORED KNOWN\n")
+	for _, reg := range r.Registers {
+		fmt.Fprintf(w, "  0x%02X 0x%08X 0x%08X 0x%08X 0x%08X %-8t %t\n", byte(reg.Addr), reg.Value,
+			reg.Volatile, reg.Toggled, reg.Writable, reg.Restored, reg.Known)
+	}
+}
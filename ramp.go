@@ -0,0 +1,106 @@
+package bm13xx
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// RampOptions tells how RampFrequency steps.
+type RampOptions struct {
+	Step  float64       // MHz per step, 6.25 if 0
+	Dwell time.Duration // wait after each step before checking the PLLs, 100ms if 0
+}
+
+// RampFrequency moves PLL0 of every chip from the frequency of the first one to
+// target MHz by steps, checking every chip PLL is locked after each one, so that
+// the current drawn does not jump. It ramps down alike, before a shutdown.
+// It returns the frequency reached, the last locked one on error.
+func (c *Chain) RampFrequency(ctx context.Context, target float64, opts RampOptions) (float64, error) {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	if len(c.Asics) == 0 {
+		return 0, fmt.Errorf("asic %w", ErrNotFound)
+	}
+	if !(opts.Step > 0) {
+		opts.Step = 6.25
+	}
+	if opts.Dwell <= 0 {
+		opts.Dwell = pllLockDwell
+	}
+	model := c.Model()
+	if _, err := model.SolvePLL(c.clk, target); err != nil {
+		return 0, err
+	}
+	pllAddr := c.pll0Addr()
+	// a written PLL0 may not have locked yet
+	if state := c.Asics[0].State(pllAddr); state != RegKnown && state != RegVerified {
+		regVal, err := c.readRegister(ctx, c.Asics[0].Addr(), pllAddr)
+		if err != nil {
+			return 0, err
+		}
+		c.setReg(0, pllAddr, regVal)
+	}
+	hz, err := c.Asics[0].PllFreq(0, c.clk)
+	if err != nil {
+		return 0, err
+	}
+	from := float64(hz) / 1e6
+	var steps []float64
+	if from == 0 {
+		// PLL off, start from the slowest setting
+		limits := model.pllLimits()
+		from = limits.MinVCO / (maxPostDiv * maxPostDiv)
+		steps = append(steps, from)
+	}
+	for f := from; f < target; {
+		f = math.Min(f+opts.Step, target)
+		steps = append(steps, f)
+	}
+	for f := from; f > target; {
+		f = math.Max(f-opts.Step, target)
+		steps = append(steps, f)
+	}
+	reached := from
+	for _, step := range steps {
+		freq, err := c.writeFrequency(true, 0, step)
+		if err != nil {
+			return reached, err
+		}
+		if err := sleep(ctx, opts.Dwell); err != nil {
+			return reached, err
+		}
+		if err := c.checkLocked(ctx, pllAddr, freq); err != nil {
+			return reached, err
+		}
+		c.setFreq(true, 0, freq)
+		reached = freq
+	}
+	return reached, nil
+}
+
+// checkLocked reads PLL0 back from every chip, ErrNotLocked if one has not locked.
+func (c *Chain) checkLocked(ctx context.Context, pllAddr RegAddr, freq float64) error {
+	model := c.Model()
+	var unlocked []string
+	for i := range c.Asics {
+		regVal, err := c.readRegister(ctx, c.Asics[i].Addr(), pllAddr)
+		if err != nil {
+			return err
+		}
+		c.setReg(i, pllAddr, regVal)
+		// LOCKED is what PllFreq reads, the models without it are trusted
+		var pll PLLParameterReg
+		pll.Decode(regVal)
+		if (model == nil || model.PLLEnableBits) && !pll.Locked {
+			unlocked = append(unlocked, fmt.Sprintf("0x%02X", c.Asics[i].Addr()))
+		}
+	}
+	if len(unlocked) > 0 {
+		return fmt.Errorf("PLL0 at %.2f MHz on chips %s %w", freq, strings.Join(unlocked, ","), ErrNotLocked)
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package bm13xx
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
 type CoreRegID byte
 
@@ -15,75 +19,9 @@ const (
 	SweepClockCtrl     CoreRegID = 7
 )
 
-var lastCoreRegID CoreRegID
 var allCoreRegisters []CoreRegID = []CoreRegID{ClockDelayCtrl, ProcessMonitorCtrl, ProcessMonitorData,
 	CoreError, CoreEnable, HashClockCtrl, HashClockCounter, SweepClockCtrl}
 
-func DumpCoreReg(regID CoreRegID, regVal uint16, debug bool) {
-	switch regID {
-	case ClockDelayCtrl:
-		fmt.Printf("  Clock Delay Control : 0x%04X\n", regVal)
-		if debug {
-			fmt.Printf("    BIT[15:8] Reserved = %02X\n", (regVal>>8)&0xff)
-		}
-		fmt.Printf("    BIT[7:6] CCDLY_SEL = %d\n", (regVal>>6)&0x03)
-		fmt.Printf("    BIT[5:4] PWTH_SEL = %d\n", (regVal>>4)&0x03)
-		fmt.Printf("    BIT[3] HASH_CLKEN = %d\n", (regVal>>3)&0x01)
-		fmt.Printf("    BIT[2] MMEN = %d\n", (regVal>>2)&0x01)
-		if debug {
-			fmt.Printf("    BIT[1] Reserved = %01X\n", (regVal>>1)&0x01)
-		}
-		fmt.Printf("    BIT[0] SWPF_MODE = %d\n", regVal&0x01)
-	case ProcessMonitorCtrl:
-		fmt.Printf("  Process Monitor Control : 0x%04X\n", regVal)
-		if debug {
-			fmt.Printf("    BIT[15:3] Reserved = %04X\n", (regVal>>3)&0x1fff)
-		}
-		fmt.Printf("    BIT[2] PM_START = %d\n", (regVal>>2)&0x01)
-		fmt.Printf("    BIT[1:0] PM_SEL = %d\n", regVal&0x03)
-	case ProcessMonitorData:
-		fmt.Printf("  Process Monitor Data : 0x%04X\n", regVal)
-		fmt.Printf("    BIT[15:0] FREQ_CNT = 0x%04X\n", regVal)
-	case CoreError:
-		fmt.Printf("  Core Error : 0x%04X\n", regVal)
-		if debug {
-			fmt.Printf("    BIT[15:5] Reserved = %03X\n", (regVal>>5)&0x7ff)
-		}
-		fmt.Printf("    BIT[4] INI_NONCE_ERR = %d\n", (regVal>>4)&0x01)
-		fmt.Printf("    BIT[3:0] CMD_ERR_CNT = %01X\n", regVal&0x0f)
-	case CoreEnable:
-		fmt.Printf("  Core Enable : 0x%04X\n", regVal)
-		if debug {
-			fmt.Printf("    BIT[15:8] Reserved = %02X\n", (regVal>>8)&0xff)
-		}
-		fmt.Printf("    BIT[7:0] CORE_EN_I = %02X\n", regVal&0xff)
-	case HashClockCtrl:
-		fmt.Printf("  Process Monitor Control : 0x%04X\n", regVal)
-		if debug {
-			fmt.Printf("    BIT[15:8] Reserved = %02X\n", (regVal>>3)&0x1fff)
-		}
-		fmt.Printf("    BIT[7:0] CLOCK_CTRL = %02X\n", regVal&0xff)
-	case HashClockCounter:
-		fmt.Printf("  Process Monitor Control : 0x%04X\n", regVal)
-		if debug {
-			fmt.Printf("    BIT[15:8] Reserved = %02X\n", (regVal>>3)&0x1fff)
-		}
-		fmt.Printf("    BIT[7:0] CLOCK_CNT = %02X\n", regVal&0xff)
-	case SweepClockCtrl:
-		fmt.Printf("  Process Monitor Control : 0x%04X\n", regVal)
-		if debug {
-			fmt.Printf("    BIT[15:8] Reserved = %02X\n", (regVal>>3)&0x1fff)
-		}
-		fmt.Printf("    BIT[7] SWPF_MODE = %d\n", (regVal>>7)&0x01)
-		if debug {
-			fmt.Printf("    BIT[6:4] Reserved = %01X\n", (regVal>>4)&0x0f)
-		}
-		fmt.Printf("    BIT[3:0] CLK_SEL = %01X\n", regVal&0x0f)
-	default:
-		fmt.Printf("  Unknown Core Register %d : 0x%04X\n", byte(regID), regVal)
-	}
-}
-
 type RegAddr byte
 
 const (
@@ -124,6 +62,7 @@ const (
 	ReturnedGroupPatternStatus    RegAddr = 0x98
 	NonceReturnedTimeout          RegAddr = 0x9C
 	ReturnedSinglePatternStatus   RegAddr = 0xA0
+	VersionRolling                RegAddr = 0xA4 // BM1366 and later only
 )
 
 var allRegisters []RegAddr = []RegAddr{ChipAddress, HashRate, PLL0Parameter, ChipNonceOffset, HashCountingNumber,
@@ -134,311 +73,239 @@ var allRegisters []RegAddr = []RegAddr{ChipAddress, HashRate, PLL0Parameter, Chi
 	Pll2Divider, Pll3Divider, ClockOrderControl0, ClockOrderControl1, ClockOrderStatus, FrequencySweepControl1,
 	GoldenNonceForSweepReturn, ReturnedGroupPatternStatus, NonceReturnedTimeout, ReturnedSinglePatternStatus}
 
-func DumpAsicReg(regAddr RegAddr, regVal uint32, debug bool) {
-	switch regAddr {
-	case ChipAddress:
-		fmt.Printf("Chip Address : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31:16] CHIP_ID = 0x%04X\n", (regVal>>16)&0xffff)
-		fmt.Printf("  BIT[15:8]  CORE_NUM = 0x%02X\n", (regVal>>8)&0xff)
-		fmt.Printf("  BIT[7:0]   ADDR = 0x%02X\n", regVal&0xff)
-	case HashRate:
-		fmt.Printf("Hash Rate : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31]   LONG = %01X\n", (regVal>>31)&0x01)
-		fmt.Printf("  BIT[30:0] HASHRATE = 0x%08X\n", regVal&0x7fffffff)
-	case PLL0Parameter:
-		fmt.Printf("PLL0 Parameter : 0x%08X\n", regVal)
-		multiplier := dumpPLLParam(regVal, debug)
-		fmt.Printf("  PLL0 Frequency : %d MHz\n", uint32(25*multiplier))
-	case ChipNonceOffset:
-		fmt.Printf("Chip Nonce Offset : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31] CNOV = %01X\n", (regVal>>31)&0x01)
-		if debug {
-			fmt.Printf("  BIT[30:16] Reserved = 0x%04X\n", (regVal>>16)&0x7fff)
-		}
-		fmt.Printf("  BIT[15:0] CNO = %04X\n", regVal&0xffff)
-	case HashCountingNumber:
-		fmt.Printf("Hash Counting Number : 0x%08X\n", regVal)
-	case TicketMask:
-		fmt.Printf("Ticket Mask : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31:24] TM3 = 0x%02X\n", (regVal>>24)&0xff)
-		fmt.Printf("  BIT[23:16] TM2 = 0x%02X\n", (regVal>>16)&0xff)
-		fmt.Printf("  BIT[15:8]  TM1 = 0x%02X\n", (regVal>>8)&0xff)
-		fmt.Printf("  BIT[7:0]   TM0 = 0x%02X\n", regVal&0xff)
-	case MiscControl:
-		fmt.Printf("Misc Control : 0x%08X\n", regVal)
-		bt8d_8_5 := (regVal >> 24) & 0x0f
-		if debug {
-			fmt.Printf("  BIT[31:23] Reserved = 0x%01X\n", (regVal>>28)&0x0f)
-			fmt.Printf("  BIT[27:24] BT8D_8_5 = 0x%01X\n", bt8d_8_5)
-			fmt.Printf("  BIT[23]    Reserved = %01X\n", (regVal>>23)&0x01)
-		}
-		fmt.Printf("  BIT[22]    CORE_SRST = %01X\n", (regVal>>22)&0x01)
-		fmt.Printf("  BIT[21]    SPAT_NOD = %01X\n", (regVal>>21)&0x01)
-		fmt.Printf("  BIT[20]    RVS_K0 = %01X\n", (regVal>>20)&0x01)
-		fmt.Printf("  BIT[19:18] DSCLK_SEL = %01X\n", (regVal>>18)&0x03)
-		fmt.Printf("  BIT[17]    TOPCLK_SEL = %01X\n", (regVal>>17)&0x01)
-		fmt.Printf("  BIT[16]    BCLK_SEL = %d (=1 if baud>3_000_000)\n", (regVal>>16)&0x01)
-		fmt.Printf("  BIT[15]    RET_ERR_NONCE = %01X\n", (regVal>>15)&0x01)
-		fmt.Printf("  BIT[14]    RFS = %01X\n", (regVal>>14)&0x01)
-		fmt.Printf("  BIT[13]    INV_CLKO = %01X\n", (regVal>>13)&0x01)
-		bt8d_4_0 := (regVal >> 8) & 0x1f
-		if debug {
-			fmt.Printf("  BIT[12:8]  BT8D_4_0 = 0x%01X\n", bt8d_4_0)
-		}
-		fmt.Printf("  calculated BT8D = %d (chip_divider)\n", (bt8d_8_5<<5)+bt8d_4_0)
-		fmt.Printf("  BIT[7]     RET_WORK_ERR_FLAG = %01X\n", (regVal>>7)&0x01)
-		fmt.Printf("  BIT[6:4]   TFS = %01X\n", (regVal>>4)&0x07)
-		if debug {
-			fmt.Printf("  BIT[3:2]   Reserved = %01X\n", (regVal>>2)&0x03)
-		}
-		fmt.Printf("  BIT[1:0]   HASHRATE_TWS = %01X\n", regVal&0x03)
-	case I2CControl:
-		fmt.Printf("Some Temperature Related : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31]    BUSY = %d\n", (regVal>>31)&0x01)
-		fmt.Printf("  BIT[30:27] Reserved = %01X\n", (regVal>>27)&0x0f)
-		fmt.Printf("  BIT[26:25] SOME_FLAGS = %01X\n", (regVal>>25)&0x03)
-		fmt.Printf("  BIT[24]    DO_CMD = %01X\n", (regVal>>24)&0x01)
-		fmt.Printf("  BIT[23:17] I2C_ADDR = %02X\n", (regVal>>17)&0x3f)
-		fmt.Printf("  BIT[16]    RD#_WR = %01X\n", (regVal>>16)&0x01)
-		fmt.Printf("  BIT[15:8]  I2C_REG_ADDR = %02X\n", (regVal>>8)&0xff)
-		fmt.Printf("  BIT[7:0]   I2C_REG_VAL = %02X\n", regVal&0xff)
-	case OrderedClockEnable:
-		fmt.Printf("Ordered Clock Enable : 0x%08X\n", regVal)
-		if debug {
-			fmt.Printf("  BIT[31:16] Reserved = 0x%04X\n", (regVal>>16)&0xffff)
-		}
-		fmt.Printf("  BIT[15:0]  CLKEN = 0x%04X\n", regVal&0xffff)
-	case FastUARTConfiguration:
-		fmt.Printf("Fast UART Configuration : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31:30] DIV4_ODDSET = %01X\n", (regVal>>30)&0x03)
-		if debug {
-			fmt.Printf("  BIT[29:28] Reserved = %01X\n", (regVal>>28)&0x03)
-		}
-		fmt.Printf("  BIT[27:24] PLL3_DIV4 = 0x%01X\n", (regVal>>24)&0x0f)
-		fmt.Printf("  BIT[23:22] USRC_ODDSET = %01X\n", (regVal>>22)&0x03)
-		fmt.Printf("  BIT[21:16] USRC_DIV = 0x%02X\n", (regVal>>16)&0x3f)
-		fmt.Printf("  BIT[15]    ForceCoreEn = %01X\n", (regVal>>15)&0x01)
-		fmt.Printf("  BIT[14]    CLKO_SEL = %01X\n", (regVal>>14)&0x01)
-		fmt.Printf("  BIT[13:12] CLKO_ODDSET = %01X\n", (regVal>>12)&0x03)
-		if debug {
-			fmt.Printf("  BIT[11:8]  Reserved = 0x%01X\n", (regVal>>8)&0x0f)
-		}
-		fmt.Printf("  BIT[7:0]   CLKO_DIV = 0x%02X\n", regVal&0xff)
-	case UARTRelay:
-		fmt.Printf("UART Relay : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31:16] GAP_CNT = 0x%04X\n", (regVal>>16)&0xffff)
-		if debug {
-			fmt.Printf("  BIT[15:2]  Reserved = 0x%04X\n", (regVal>>2)&0x3fff)
-		}
-		fmt.Printf("  BIT[1]     RO_RELAY_EN = %01X\n", (regVal>>1)&0x01)
-		fmt.Printf("  BIT[0]     CO_RELAY_EN = %01X\n", regVal&0x01)
-	case TicketMask2:
-		fmt.Printf("Ticket Mask2 : 0x%08X\n", regVal)
-	case CoreRegisterControl:
-		fmt.Printf("Core Register Control : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31]    WR_RD#_MSB? = %d\n", (regVal>>31)&0x01)
-		fmt.Printf("  BIT[30:24] Always0x7e? = 0x%02X\n", (regVal>>24)&0x7f)
-		fmt.Printf("  BIT[23:16] CORE_ID = %d\n", (regVal>>16)&0xff)
-		fmt.Printf("  BIT[15]    WR_RD#_LSB? = %d\n", (regVal>>15)&0x01)
-		fmt.Printf("  BIT[14:12] Always3? = %d\n", (regVal>>12)&0x07)
-		fmt.Printf("  BIT[11:8]  CORE_REG_ID = %d\n", (regVal>>8)&0x0f)
-		fmt.Printf("  BIT[7:0]   CORE_REG_VAL = 0x%02X\n", regVal&0xff)
-		DumpCoreReg(CoreRegID((regVal>>8)&0x0f), uint16(regVal&0xff), debug)
-		if (regVal>>15)&0x01 == 0 { // Read Core Register
-			lastCoreRegID = CoreRegID((regVal >> 8) & 0x0f)
-		}
-	case CoreRegisterValue:
-		fmt.Printf("Core Register Value : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31:16] CORE_ID = %d\n", (regVal>>16)&0xffff)
-		fmt.Printf("  BIT[15:0]  CORE_REG_VAL = 0x%04X\n", regVal&0xffff)
-		DumpCoreReg(lastCoreRegID, uint16(regVal&0xffff), debug)
-	case ExternalTemperatureSensorRead:
-		fmt.Printf("External Temperature Sensor Read : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31:24] LOCAL_TEMP_ADDR = 0x%02X\n", (regVal>>24)&0xff)
-		fmt.Printf("  BIT[23:16] LOCAL_TEMP_DATA = 0x%02X\n", (regVal>>16)&0xff)
-		fmt.Printf("  BIT[15:8]  EXTERNAL_TEMP_ADDR = 0x%02X\n", (regVal>>8)&0xff)
-		fmt.Printf("  BIT[7:0]   EXTERNAL_TEMP_DATA = 0x%02X\n", regVal&0xff)
-	case ErrorFlag:
-		fmt.Printf("Error Flag : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31:24] CMD_ERR_CNT = 0x%02X\n", regVal&0xff)
-		fmt.Printf("  BIT[23:16] WORK_ERR_CNT = 0x%02X\n", (regVal>>8)&0xff)
-		if debug {
-			fmt.Printf("  BIT[15:8]  Reserved = 0x%02X\n", (regVal>>16)&0xff)
-		}
-		fmt.Printf("  BIT[7:0]   CORE_RESP_ERR = 0x%02X\n", (regVal>>24)&0xff)
-	case NonceErrorCounter:
-		fmt.Printf("Nonce Error Counter : 0x%08X\n", regVal)
-	case NonceOverflowCounter:
-		fmt.Printf("Nonce Overflow Counter : 0x%08X\n", regVal)
-	case AnalogMuxControl:
-		fmt.Printf("Analog Mux Control : 0x%08X\n", regVal)
-		if debug {
-			fmt.Printf("  BIT[31:3] Reserved = 0x%08X\n", regVal>>3)
-		}
-		fmt.Printf("  BIT[2:0] DIODE_VDD_MUX_SEL = %01X\n", regVal&0x07)
-	case IoDriverStrenghtConfiguration:
-		fmt.Printf("Io Driver Strenght Configuration : 0x%08X\n", regVal)
-		if debug {
-			fmt.Printf("  BIT[31:28] Reserved = 0x%01X\n", (regVal>>28)&0x0f)
-		}
-		fmt.Printf("  BIT[27:24] RF_DS = 0x%01X\n", (regVal>>24)&0x0f)
-		fmt.Printf("  BIT[23]    D3RS_DISA = %01X\n", (regVal>>23)&0x01)
-		fmt.Printf("  BIT[22]    D2RS_DISA = %01X\n", (regVal>>22)&0x01)
-		fmt.Printf("  BIT[21]    D1RS_DISA = %01X\n", (regVal>>21)&0x01)
-		fmt.Printf("  BIT[20]    D0RS_EN = %01X\n", (regVal>>20)&0x01)
-		fmt.Printf("  BIT[19:16] R0_DS = 0x%01X\n", (regVal>>16)&0x0f)
-		fmt.Printf("  BIT[15:12] CLKO_DS = 0x%01X\n", (regVal>>12)&0x0f)
-		fmt.Printf("  BIT[11:8]  NRSTO_DS = 0x%01X\n", (regVal>>8)&0x0f)
-		fmt.Printf("  BIT[7:4]   BO_DS = 0x%01X\n", (regVal>>4)&0x0f)
-		fmt.Printf("  BIT[3:0]   CO_DS = 0x%01X\n", regVal&0x0f)
-	case TimeOut:
-		fmt.Printf("Time Out : 0x%08X\n", regVal)
-		if debug {
-			fmt.Printf("  BIT[31:16] Reserved = 0x%04X\n", (regVal>>16)&0xffff)
-		}
-		fmt.Printf("  BIT[15:0]  TMOUT = 0x%04X\n", regVal&0xffff)
-	case PLL1Parameter:
-		fmt.Printf("PLL1 Parameter : 0x%08X\n", regVal)
-		multiplier := dumpPLLParam(regVal, debug)
-		fmt.Printf("  PLL1 Frequency : %d MHz\n", uint32(25*multiplier))
-	case PLL2Parameter:
-		fmt.Printf("PLL2 Parameter : 0x%08X\n", regVal)
-		multiplier := dumpPLLParam(regVal, debug)
-		fmt.Printf("  PLL2 Frequency : %d MHz\n", uint32(25*multiplier))
-	case PLL3Parameter:
-		fmt.Printf("PLL3 Parameter : 0x%08X\n", regVal)
-		multiplier := dumpPLLParam(regVal, debug)
-		fmt.Printf("  PLL3 Frequency : %d MHz\n", uint32(25*multiplier))
-	case OrderedClockMonitor:
-		fmt.Printf("Ordered Clock Monitor : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31]    START = 0x%01X\n", (regVal>>31)&0x01)
-		if debug {
-			fmt.Printf("  BIT[30:28] Reserved = 0x%01X\n", (regVal>>28)&0x07)
-		}
-		fmt.Printf("  BIT[27:24] CLK_SEL = 0x%01X\n", (regVal>>24)&0x0f)
-		if debug {
-			fmt.Printf("  BIT[23:16] Reserved = 0x%02X\n", (regVal>>16)&0xff)
-		}
-		fmt.Printf("  BIT[15:0]  CLK_COUNT = 0x%04X\n", regVal&0xffff)
-	case Pll0Divider:
-		fmt.Printf("Pll0 Divider : 0x%08X\n", regVal)
-		dumpPLLDiv(regVal, debug)
-	case Pll1Divider:
-		fmt.Printf("Pll1 Divider : 0x%08X\n", regVal)
-		dumpPLLDiv(regVal, debug)
-	case Pll2Divider:
-		fmt.Printf("Pll2 Divider : 0x%08X\n", regVal)
-		dumpPLLDiv(regVal, debug)
-	case Pll3Divider:
-		fmt.Printf("Pll3 Divider : 0x%08X\n", regVal)
-		dumpPLLDiv(regVal, debug)
-	case ClockOrderControl0:
-		fmt.Printf("Clock Order Control0 : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31:28] CLK7_SEL = 0x%01X\n", (regVal>>28)&0x0f)
-		fmt.Printf("  BIT[27:24] CLK6_SEL = 0x%01X\n", (regVal>>24)&0x0f)
-		fmt.Printf("  BIT[23:20] CLK5_SEL = 0x%01X\n", (regVal>>20)&0x0f)
-		fmt.Printf("  BIT[19:16] CLK4_SEL = 0x%01X\n", (regVal>>16)&0x0f)
-		fmt.Printf("  BIT[15:12] CLK3_SEL = 0x%01X\n", (regVal>>12)&0x0f)
-		fmt.Printf("  BIT[11:8]  CLK2_SEL = 0x%01X\n", (regVal>>8)&0x0f)
-		fmt.Printf("  BIT[7:4]   CLK1_SEL = 0x%01X\n", (regVal>>4)&0x0f)
-		fmt.Printf("  BIT[3:0]   CLK0_SEL = 0x%01X\n", regVal&0x0f)
-	case ClockOrderControl1:
-		fmt.Printf("Clock Order Control1 : 0x%08X\n", regVal)
-		fmt.Printf("  BIT[31:28] CLK15_SEL = 0x%01X\n", (regVal>>28)&0x0f)
-		fmt.Printf("  BIT[27:24] CLK14_SEL = 0x%01X\n", (regVal>>24)&0x0f)
-		fmt.Printf("  BIT[23:20] CLK13_SEL = 0x%01X\n", (regVal>>20)&0x0f)
-		fmt.Printf("  BIT[19:16] CLK12_SEL = 0x%01X\n", (regVal>>16)&0x0f)
-		fmt.Printf("  BIT[15:12] CLK11_SEL = 0x%01X\n", (regVal>>12)&0x0f)
-		fmt.Printf("  BIT[11:8]  CLK10_SEL = 0x%01X\n", (regVal>>8)&0x0f)
-		fmt.Printf("  BIT[7:4]   CLK9_SEL = 0x%01X\n", (regVal>>4)&0x0f)
-		fmt.Printf("  BIT[3:0]   CLK8_SEL = 0x%01X\n", regVal&0x0f)
-	case ClockOrderStatus:
-		fmt.Printf("Clock Order Status : 0x%08X\n", regVal)
-	case FrequencySweepControl1:
-		fmt.Printf("Frequency Sweep Control1 : 0x%08X\n", regVal)
-		if debug {
-			fmt.Printf("  BIT[31:27] Reserved = 0x%02X\n", regVal>>27)
-		}
-		fmt.Printf("  BIT[26:24] SWEEP_STATE = %01X\n", (regVal>>24)&0x07)
-		if debug {
-			fmt.Printf("  BIT[23:21] Reserved = %01X\n", (regVal>>21)&0x07)
-		}
-		fmt.Printf("  BIT[20:16] SWEEP_ST_ADDR = 0x%02X\n", (regVal>>16)&0x07)
-		if debug {
-			fmt.Printf("  BIT[15:14] Reserved = %01X\n", (regVal>>14)&0x03)
-		}
-		fmt.Printf("  BIT[13]    ALL_CORE_CLK_SEL_CHANGE_ST = %01X\n", (regVal>>13)&0x01)
-		fmt.Printf("  BIT[12]    SWEEP_FAIL_LOCK_EN = %01X\n", (regVal>>12)&0x01)
-		fmt.Printf("  BIT[11]    SWEEP_RESET = %01X\n", (regVal>>11)&0x01)
-		fmt.Printf("  BIT[10:8]  CURR_PAT_ADDR = %01X\n", (regVal>>8)&0x07)
-		fmt.Printf("  BIT[7]     SWP_ONE_PAT_DONE = %01X\n", (regVal>>7)&0x01)
-		fmt.Printf("  BIT[6:4]   SWP_PAD_ADDR = %01X\n", (regVal>>4)&0x07)
-		fmt.Printf("  BIT[3]     SWP_DONE_ALL = %01X\n", (regVal>>3)&0x01)
-		fmt.Printf("  BIT[2]     SWP_ONGOING = %01X\n", (regVal>>2)&0x01)
-		fmt.Printf("  BIT[1]     SWP_TRIG = %01X\n", (regVal>>1)&0x01)
-		fmt.Printf("  BIT[0]     SWP_EN = %01X\n", regVal&0x01)
-	case GoldenNonceForSweepReturn:
-		fmt.Printf("Golden Nonce For Sweep Return : 0x%08X\n", regVal)
-	case ReturnedGroupPatternStatus:
-		fmt.Printf("Returned Group Pattern Status : 0x%08X\n", regVal)
-	case NonceReturnedTimeout:
-		fmt.Printf("Nonce Returned Timeout : 0x%08X\n", regVal)
-		if debug {
-			fmt.Printf("  BIT[31:16] Reserved = 0x%04X\n", (regVal>>16)&0xffff)
-		}
-		fmt.Printf("  BIT[15:0]  SWEEP_TIMEOUT = 0x%04X\n", regVal&0xffff)
-	case ReturnedSinglePatternStatus:
-		fmt.Printf("Returned Single Pattern Status : 0x%08X\n", regVal)
-	default:
-		fmt.Printf("Unknown Register 0x%02X : 0x%08X\n", byte(regAddr), regVal)
+// BM1387 registers, the BM1397 ones do not apply
+const (
+	BM1387ChipAddress        RegAddr = 0x00
+	BM1387GoldenNonce        RegAddr = 0x08
+	BM1387PLLParameter       RegAddr = 0x0C
+	BM1387StartNonceOffset   RegAddr = 0x10
+	BM1387HashCountingNumber RegAddr = 0x14
+	BM1387TicketMask         RegAddr = 0x18
+	BM1387MiscControl        RegAddr = 0x1C
+	BM1387I2CCommand         RegAddr = 0x20
+)
+
+var allBM1387Registers []RegAddr = []RegAddr{BM1387ChipAddress, BM1387GoldenNonce, BM1387PLLParameter,
+	BM1387StartNonceOffset, BM1387HashCountingNumber, BM1387TicketMask, BM1387MiscControl, BM1387I2CCommand}
+
+var bm1366Family = []string{"BM1366", "BM1368", "BM1370"}
+
+var pllParamFields = []FieldSchema{{"LOCKED", 31, 31, ReadOnly}, {"PLLEN", 30, 30, ""},
+	{"FBDIV", 27, 16, ""}, {"REFDIV", 13, 8, ""}, {"POSTDIV1", 6, 4, ""}, {"POSTDIV2", 2, 0, ""}}
+
+var pllParamDec = []string{"FBDIV", "REFDIV", "POSTDIV1", "POSTDIV2"}
+
+var pllDivFields = []FieldSchema{{"PLL_DIV3", 27, 24, ""}, {"PLL_DIV2", 19, 16, ""},
+	{"PLL_DIV1", 11, 8, ""}, {"PLL_DIV0", 3, 0, ""}}
+
+var pllDivDec = []string{"PLL_DIV3", "PLL_DIV2", "PLL_DIV1", "PLL_DIV0"}
+
+var clockOrderFields = func(first int) []FieldSchema {
+	var fields []FieldSchema
+	for i := 7; i >= 0; i-- {
+		fields = append(fields, FieldSchema{Name: fmt.Sprintf("CLK%d_SEL", first+i), Hi: uint(4*i + 3), Lo: uint(4 * i)})
 	}
+	return fields
 }
 
-func dumpPLLParam(regVal uint32, debug bool) float32 {
-	fmt.Printf("  BIT[31] LOCKED = %d\n", (regVal>>31)&0x01)
-	pllEn := (regVal >> 30) & 0x01
-	fmt.Printf("  BIT[30] PLLEN = %d\n", pllEn)
-	if debug {
-		fmt.Printf("  BIT[29:28] Reserved = %01X\n", (regVal>>28)&0x03)
-	}
-	fbdiv := (regVal >> 16) & 0xfff
-	fmt.Printf("  BIT[27:16] FBDIV = %d\n", fbdiv)
-	if debug {
-		fmt.Printf("  BIT[15:14] Reserved = %01X\n", (regVal>>14)&0x03)
-	}
-	refdiv := (regVal >> 8) & 0x3f
-	fmt.Printf("  BIT[13:8] REFDIV = %d\n", refdiv)
-	if debug {
-		fmt.Printf("  BIT[7] Reserved = %01X\n", (regVal>>7)&0x01)
-	}
-	postdiv1 := (regVal >> 4) & 0x07
-	fmt.Printf("  BIT[6:4] POSTDIV1 = %d\n", postdiv1)
-	if debug {
-		fmt.Printf("  BIT[3] Reserved = %01X\n", (regVal>>3)&0x01)
+// DefaultSchema is the layout of the registers of the known chip models.
+var DefaultSchema = func() *Schema {
+	s := &Schema{
+		Registers: []RegisterSchema{
+			{Name: "Chip Address", Addr: ChipAddress, Access: ReadWrite, Fields: []FieldSchema{
+				{"CHIP_ID", 31, 16, ReadOnly}, {"CORE_NUM", 15, 8, ReadOnly}, {"ADDR", 7, 0, ""}}},
+			{Name: "Hash Rate", Addr: HashRate, Access: ReadOnly, Fields: []FieldSchema{
+				{"LONG", 31, 31, ""}, {"HASHRATE", 30, 0, ""}}},
+			{Name: "PLL0 Parameter", Addr: PLL0Parameter, Access: ReadWrite, Fields: pllParamFields, Dec: pllParamDec},
+			{Name: "Chip Nonce Offset", Addr: ChipNonceOffset, Access: ReadWrite, Fields: []FieldSchema{
+				{"CNOV", 31, 31, ""}, {"CNO", 15, 0, ""}}},
+			{Name: "Hash Counting Number", Addr: HashCountingNumber, Access: ReadWrite},
+			{Name: "Ticket Mask", Addr: TicketMask, Access: ReadWrite, Fields: []FieldSchema{
+				{"TM3", 31, 24, ""}, {"TM2", 23, 16, ""}, {"TM1", 15, 8, ""}, {"TM0", 7, 0, ""}}},
+			{Name: "Misc Control", Addr: MiscControl, Access: ReadWrite, Reset: 0x00003A01, Fields: []FieldSchema{
+				{"BT8D_8_5", 27, 24, ""}, {"CORE_SRST", 22, 22, ""}, {"SPAT_NOD", 21, 21, ""}, {"RVS_K0", 20, 20, ""},
+				{"DSCLK_SEL", 19, 18, ""}, {"TOPCLK_SEL", 17, 17, ""}, {"BCLK_SEL", 16, 16, ""},
+				{"RET_ERR_NONCE", 15, 15, ""}, {"RFS", 14, 14, ""}, {"INV_CLKO", 13, 13, ""}, {"BT8D_4_0", 12, 8, ""},
+				{"RET_WORK_ERR_FLAG", 7, 7, ""}, {"TFS", 6, 4, ""}, {"HASHRATE_TWS", 1, 0, ""}},
+				Notes: map[string]string{"BCLK_SEL": "(=1 if baud>3_000_000)"}},
+			{Name: "I2C Control", Label: "Some Temperature Related", Addr: I2CControl, Access: ReadWrite, Fields: []FieldSchema{
+				{"BUSY", 31, 31, ReadOnly}, {"SOME_FLAGS", 26, 25, ""}, {"DO_CMD", 24, 24, SelfClearing},
+				{"I2C_ADDR", 23, 17, ""}, {"RD#_WR", 16, 16, ""}, {"I2C_REG_ADDR", 15, 8, ""}, {"I2C_REG_VAL", 7, 0, ""}}},
+			{Name: "Ordered Clock Enable", Addr: OrderedClockEnable, Access: ReadWrite, Fields: []FieldSchema{
+				{"CLKEN", 15, 0, ""}}},
+			{Name: "Fast UART Configuration", Addr: FastUARTConfiguration, Access: ReadWrite, Fields: []FieldSchema{
+				{"DIV4_ODDSET", 31, 30, ""}, {"PLL3_DIV4", 27, 24, ""}, {"USRC_ODDSET", 23, 22, ""},
+				{"USRC_DIV", 21, 16, ""}, {"ForceCoreEn", 15, 15, ""}, {"CLKO_SEL", 14, 14, ""},
+				{"CLKO_ODDSET", 13, 12, ""}, {"CLKO_DIV", 7, 0, ""}}},
+			{Name: "UART Relay", Addr: UARTRelay, Access: ReadWrite, Fields: []FieldSchema{
+				{"GAP_CNT", 31, 16, ""}, {"RO_RELAY_EN", 1, 1, ""}, {"CO_RELAY_EN", 0, 0, ""}}},
+			{Name: "Ticket Mask2", Addr: TicketMask2, Access: ReadWrite},
+			{Name: "Core Register Control", Addr: CoreRegisterControl, Access: ReadWrite, Fields: []FieldSchema{
+				{"WR_RD#_MSB", 31, 31, ""}, {"Always0x7e?", 30, 24, Unknown}, {"CORE_ID", 23, 16, ""},
+				{"WR_RD#_LSB", 15, 15, ""}, {"Always3?", 14, 12, Unknown}, {"CORE_REG_ID", 11, 8, ""},
+				{"CORE_REG_VAL", 7, 0, ""}},
+				Dec: []string{"CORE_ID", "Always3?", "CORE_REG_ID"}},
+			{Name: "Core Register Value", Addr: CoreRegisterValue, Access: ReadOnly, Fields: []FieldSchema{
+				{"CORE_ID", 31, 16, ""}, {"CORE_REG_VAL", 15, 0, ""}}, Dec: []string{"CORE_ID"}},
+			{Name: "External Temperature Sensor Read", Addr: ExternalTemperatureSensorRead, Access: ReadOnly, Fields: []FieldSchema{
+				{"LOCAL_TEMP_ADDR", 31, 24, ""}, {"LOCAL_TEMP_DATA", 23, 16, ""},
+				{"EXTERNAL_TEMP_ADDR", 15, 8, ""}, {"EXTERNAL_TEMP_DATA", 7, 0, ""}}},
+			{Name: "Error Flag", Addr: ErrorFlag, Access: ReadOnly, Fields: []FieldSchema{
+				{"CMD_ERR_CNT", 31, 24, ""}, {"WORK_ERR_CNT", 23, 16, ""}, {"CORE_RESP_ERR", 7, 0, ""}}},
+			{Name: "Nonce Error Counter", Addr: NonceErrorCounter, Access: ReadOnly},
+			{Name: "Nonce Overflow Counter", Addr: NonceOverflowCounter, Access: ReadOnly},
+			{Name: "Analog Mux Control", Addr: AnalogMuxControl, Access: ReadWrite, Fields: []FieldSchema{
+				{"DIODE_VDD_MUX_SEL", 2, 0, ""}}},
+			{Name: "Io Driver Strenght Configuration", Addr: IoDriverStrenghtConfiguration, Access: ReadWrite, Fields: []FieldSchema{
+				{"RF_DS", 27, 24, ""}, {"D3RS_DISA", 23, 23, ""}, {"D2RS_DISA", 22, 22, ""}, {"D1RS_DISA", 21, 21, ""},
+				{"D0RS_EN", 20, 20, ""}, {"R0_DS", 19, 16, ""}, {"CLKO_DS", 15, 12, ""}, {"NRSTO_DS", 11, 8, ""},
+				{"BO_DS", 7, 4, ""}, {"CO_DS", 3, 0, ""}}},
+			{Name: "Time Out", Addr: TimeOut, Access: ReadWrite, Fields: []FieldSchema{{"TMOUT", 15, 0, ""}}},
+			{Name: "PLL1 Parameter", Addr: PLL1Parameter, Access: ReadWrite, Fields: pllParamFields, Dec: pllParamDec},
+			{Name: "PLL2 Parameter", Addr: PLL2Parameter, Access: ReadWrite, Fields: pllParamFields, Dec: pllParamDec},
+			{Name: "PLL3 Parameter", Addr: PLL3Parameter, Access: ReadWrite, Fields: pllParamFields, Dec: pllParamDec},
+			{Name: "Ordered Clock Monitor", Addr: OrderedClockMonitor, Access: ReadWrite, Fields: []FieldSchema{
+				{"START", 31, 31, SelfClearing}, {"CLK_SEL", 27, 24, ""}, {"CLK_COUNT", 15, 0, ReadOnly}}},
+			{Name: "Pll0 Divider", Addr: Pll0Divider, Access: ReadWrite, Fields: pllDivFields, Dec: pllDivDec},
+			{Name: "Pll1 Divider", Addr: Pll1Divider, Access: ReadWrite, Fields: pllDivFields, Dec: pllDivDec},
+			{Name: "Pll2 Divider", Addr: Pll2Divider, Access: ReadWrite, Fields: pllDivFields, Dec: pllDivDec},
+			{Name: "Pll3 Divider", Addr: Pll3Divider, Access: ReadWrite, Fields: pllDivFields, Dec: pllDivDec},
+			{Name: "Clock Order Control0", Addr: ClockOrderControl0, Access: ReadWrite, Fields: clockOrderFields(0)},
+			{Name: "Clock Order Control1", Addr: ClockOrderControl1, Access: ReadWrite, Fields: clockOrderFields(8)},
+			{Name: "Clock Order Status", Addr: ClockOrderStatus, Access: ReadOnly},
+			{Name: "Frequency Sweep Control1", Addr: FrequencySweepControl1, Access: ReadWrite, Fields: []FieldSchema{
+				{"SWEEP_STATE", 26, 24, ReadOnly}, {"SWEEP_ST_ADDR", 20, 16, ""},
+				{"ALL_CORE_CLK_SEL_CHANGE_ST", 13, 13, ""}, {"SWEEP_FAIL_LOCK_EN", 12, 12, ""},
+				{"SWEEP_RESET", 11, 11, ""}, {"CURR_PAT_ADDR", 10, 8, ReadOnly}, {"SWP_ONE_PAT_DONE", 7, 7, ReadOnly},
+				{"SWP_PAT_ADDR", 6, 4, ""}, {"SWP_DONE_ALL", 3, 3, ReadOnly}, {"SWP_ONGOING", 2, 2, ReadOnly},
+				{"SWP_TRIG", 1, 1, SelfClearing}, {"SWP_EN", 0, 0, ""}}},
+			{Name: "Golden Nonce For Sweep Return", Addr: GoldenNonceForSweepReturn, Access: ReadOnly},
+			{Name: "Returned Group Pattern Status", Addr: ReturnedGroupPatternStatus, Access: ReadOnly},
+			{Name: "Nonce Returned Timeout", Addr: NonceReturnedTimeout, Access: ReadWrite, Fields: []FieldSchema{
+				{"SWEEP_TIMEOUT", 15, 0, ""}}},
+			{Name: "Returned Single Pattern Status", Addr: ReturnedSinglePatternStatus, Access: ReadOnly},
+			{Name: "Version Rolling", Addr: VersionRolling, Access: ReadWrite, Models: bm1366Family, Fields: []FieldSchema{
+				{"EN", 31, 31, ""}, {"MASK", 15, 0, ""}}},
+
+			{Name: "Golden Nonce", Addr: BM1387GoldenNonce, Access: ReadOnly, Models: []string{"BM1387"}},
+			{Name: "PLL Parameter", Addr: BM1387PLLParameter, Access: ReadWrite, Models: []string{"BM1387"}, Fields: []FieldSchema{
+				{"FBDIV", 23, 16, ""}, {"REFDIV", 11, 8, ""}, {"POSTDIV1", 6, 4, ""}, {"POSTDIV2", 2, 0, ""}},
+				Dec: pllParamDec},
+			{Name: "Start Nonce Offset", Addr: BM1387StartNonceOffset, Access: ReadWrite, Models: []string{"BM1387"}},
+			{Name: "Hash Counting Number", Addr: BM1387HashCountingNumber, Access: ReadWrite, Models: []string{"BM1387"}},
+			{Name: "Ticket Mask", Addr: BM1387TicketMask, Access: ReadWrite, Models: []string{"BM1387"}},
+			{Name: "Misc Control", Addr: BM1387MiscControl, Access: ReadWrite, Reset: 0x00001A00, Models: []string{"BM1387"}, Fields: []FieldSchema{
+				{"BT8D", 12, 8, ""}},
+				Dec: []string{"BT8D"}, Notes: map[string]string{"BT8D": "(baud = 25MHz / ((BT8D + 1) * 8))"}},
+			{Name: "General I2C Command", Addr: BM1387I2CCommand, Access: ReadWrite, Models: []string{"BM1387"}},
+		},
+		CoreRegisters: []RegisterSchema{
+			{Name: "Clock Delay Control", Addr: RegAddr(ClockDelayCtrl), Access: ReadWrite, Fields: []FieldSchema{
+				{"CCDLY_SEL", 7, 6, ""}, {"PWTH_SEL", 5, 4, ""}, {"HASH_CLKEN", 3, 3, ""}, {"MMEN", 2, 2, ""},
+				{"SWPF_MODE", 0, 0, ""}},
+				Dec: []string{"CCDLY_SEL", "PWTH_SEL"}},
+			{Name: "Process Monitor Control", Addr: RegAddr(ProcessMonitorCtrl), Access: ReadWrite, Fields: []FieldSchema{
+				{"PM_START", 2, 2, SelfClearing}, {"PM_SEL", 1, 0, ""}}, Dec: []string{"PM_SEL"}},
+			{Name: "Process Monitor Data", Addr: RegAddr(ProcessMonitorData), Access: ReadOnly, Fields: []FieldSchema{
+				{"FREQ_CNT", 15, 0, ""}}},
+			{Name: "Core Error", Addr: RegAddr(CoreError), Access: ReadOnly, Fields: []FieldSchema{
+				{"INI_NONCE_ERR", 4, 4, ""}, {"CMD_ERR_CNT", 3, 0, ""}}},
+			{Name: "Core Enable", Addr: RegAddr(CoreEnable), Access: ReadWrite, Fields: []FieldSchema{
+				{"CORE_EN_I", 7, 0, ""}}},
+			{Name: "Hash Clock Control", Addr: RegAddr(HashClockCtrl), Access: ReadWrite, Fields: []FieldSchema{
+				{"CLOCK_CTRL", 7, 0, ""}}},
+			{Name: "Hash Clock Counter", Addr: RegAddr(HashClockCounter), Access: ReadOnly, Fields: []FieldSchema{
+				{"CLOCK_CNT", 7, 0, ""}}},
+			{Name: "Sweep Clock Control", Addr: RegAddr(SweepClockCtrl), Access: ReadWrite, Fields: []FieldSchema{
+				{"SWPF_MODE", 7, 7, ""}, {"CLK_SEL", 3, 0, ""}}},
+		},
 	}
-	postdiv2 := regVal & 0x07
-	fmt.Printf("  BIT[2:0] POSTDIV2 = %d\n", postdiv2)
-	if pllEn == 1 {
-		return float32(fbdiv / (refdiv * postdiv1 * postdiv2))
+	s.init()
+	return s
+}()
+
+func DumpCoreReg(regID CoreRegID, regVal uint16, debug bool) {
+	FprintCoreReg(os.Stdout, regID, regVal, debug)
+}
+
+// FprintCoreReg writes the fields of a core register value to w.
+func FprintCoreReg(w io.Writer, regID CoreRegID, regVal uint16, debug bool) {
+	fprintCoreReg(w, DefaultSchema, regID, regVal, debug)
+}
+
+func DumpAsicReg(regAddr RegAddr, regVal uint32, debug bool) {
+	FprintAsicReg(os.Stdout, regAddr, regVal, debug)
+}
+
+// FprintAsicReg writes the fields of a register value to w.
+func FprintAsicReg(w io.Writer, regAddr RegAddr, regVal uint32, debug bool) {
+	fprintReg(w, DefaultSchema, "", regAddr, regVal, debug, new(CoreRegID))
+}
+
+func DumpBM1387Reg(regAddr RegAddr, regVal uint32, debug bool) {
+	FprintBM1387Reg(os.Stdout, regAddr, regVal, debug)
+}
+
+// FprintBM1387Reg writes the fields of a BM1387 register value to w.
+func FprintBM1387Reg(w io.Writer, regAddr RegAddr, regVal uint32, debug bool) {
+	fprintReg(w, DefaultSchema, BM1387.Name, regAddr, regVal, debug, new(CoreRegID))
+}
+
+func fprintCoreReg(w io.Writer, s *Schema, regID CoreRegID, regVal uint16, debug bool) {
+	r := s.CoreRegister(regID)
+	if r == nil {
+		fmt.Fprintf(w, "  Unknown Core Register %d : 0x%04X\n", byte(regID), regVal)
+		return
 	}
-	return 0
+	r.Fprint(w, uint32(regVal), debug)
 }
 
-func dumpPLLDiv(regVal uint32, debug bool) {
-	if debug {
-		fmt.Printf("  BIT[31:28] Reserved = 0x%01X\n", (regVal>>28)&0x0f)
+// fprintReg writes a register with the values derived from its fields. lastCoreRegID
+// is the core register read by the last CoreRegisterControl of the dump, which
+// CoreRegisterValue holds.
+func fprintReg(w io.Writer, s *Schema, model string, regAddr RegAddr, regVal uint32, debug bool, lastCoreRegID *CoreRegID) {
+	r := s.Register(model, regAddr)
+	if r == nil {
+		fmt.Fprintf(w, "Unknown Register 0x%02X : 0x%08X\n", byte(regAddr), regVal)
+		return
 	}
-	fmt.Printf("  BIT[27:24] PLL_DIV3 = %d\n", (regVal>>24)&0x0f)
-	if debug {
-		fmt.Printf("  BIT[23:20] Reserved = 0x%01X\n", (regVal>>20)&0x0f)
+	r.Fprint(w, regVal, debug)
+	if model == BM1387.Name {
+		if regAddr == BM1387PLLParameter {
+			pll := DefaultSchema.Register(BM1387.Name, BM1387PLLParameter)
+			fbdiv, refdiv := pll.get(regVal, "FBDIV"), pll.get(regVal, "REFDIV")
+			postdiv1, postdiv2 := pll.get(regVal, "POSTDIV1"), pll.get(regVal, "POSTDIV2")
+			if refdiv*postdiv1*postdiv2 != 0 {
+				fmt.Fprintf(w, "  PLL Frequency : %d MHz\n", 25*fbdiv/(refdiv*postdiv1*postdiv2))
+			}
+		}
+		return
 	}
-	fmt.Printf("  BIT[19:16] PLL_DIV2 = %d\n", (regVal>>16)&0x0f)
-	if debug {
-		fmt.Printf("  BIT[15:12] Reserved = 0x%01X\n", (regVal>>12)&0x0f)
+	switch regAddr {
+	case PLL0Parameter, PLL1Parameter, PLL2Parameter, PLL3Parameter:
+		fmt.Fprintf(w, "  %s Frequency : %d MHz\n", r.Name[:4], uint32(25*pllMultiplier(regVal)))
+	case MiscControl:
+		var misc MiscControlReg
+		misc.Decode(regVal)
+		fmt.Fprintf(w, "  calculated BT8D = %d (chip_divider)\n", misc.BT8D)
+	case CoreRegisterControl:
+		var ctrl CoreRegisterControlReg
+		ctrl.Decode(regVal)
+		fprintCoreReg(w, s, ctrl.CoreRegID, uint16(ctrl.Value), debug)
+		if !ctrl.Write { // Read Core Register
+			*lastCoreRegID = ctrl.CoreRegID
+		}
+	case CoreRegisterValue:
+		fprintCoreReg(w, s, *lastCoreRegID, uint16(regVal&0xffff), debug)
 	}
-	fmt.Printf("  BIT[11:8]  PLL_DIV1 = %d\n", (regVal>>8)&0x0f)
-	if debug {
-		fmt.Printf("  BIT[7:4]   Reserved = 0x%01X\n", (regVal>>4)&0x0f)
+}
+
+func pllMultiplier(regVal uint32) float32 {
+	var pll PLLParameterReg
+	pll.Decode(regVal)
+	divide := uint32(pll.RefDiv) * uint32(pll.PostDiv1) * uint32(pll.PostDiv2)
+	if pll.PLLEn && divide != 0 {
+		return float32(uint32(pll.FBDiv) / divide)
 	}
-	fmt.Printf("  BIT[3:0]   PLL_DIV0 = %d\n", regVal&0x0f)
+	return 0
 }
@@ -0,0 +1,803 @@
+package bm13xx
+
+// Register is the typed view of a register value. Decode keeps the reserved bits
+// so that Encode gives them back untouched.
+type Register interface {
+	Decode(regVal uint32)
+	Encode() uint32
+}
+
+func bitsOf(regVal uint32, hi, lo uint) uint32 {
+	return regVal >> lo & (1<<(hi-lo+1) - 1)
+}
+
+func putBits(val uint32, hi, lo uint) uint32 {
+	return val & (1<<(hi-lo+1) - 1) << lo
+}
+
+// The typed registers take their fields from DefaultSchema, by name.
+var (
+	chipAddressSchema         = DefaultSchema.Register("", ChipAddress)
+	hashRateSchema            = DefaultSchema.Register("", HashRate)
+	chipNonceOffsetSchema     = DefaultSchema.Register("", ChipNonceOffset)
+	ticketMaskSchema          = DefaultSchema.Register("", TicketMask)
+	miscControlSchema         = DefaultSchema.Register("", MiscControl)
+	i2cControlSchema          = DefaultSchema.Register("", I2CControl)
+	orderedClockEnableSchema  = DefaultSchema.Register("", OrderedClockEnable)
+	fastUARTConfigSchema      = DefaultSchema.Register("", FastUARTConfiguration)
+	uartRelaySchema           = DefaultSchema.Register("", UARTRelay)
+	coreRegControlSchema      = DefaultSchema.Register("", CoreRegisterControl)
+	coreRegValueSchema        = DefaultSchema.Register("", CoreRegisterValue)
+	extTempSensorSchema       = DefaultSchema.Register("", ExternalTemperatureSensorRead)
+	errorFlagSchema           = DefaultSchema.Register("", ErrorFlag)
+	analogMuxControlSchema    = DefaultSchema.Register("", AnalogMuxControl)
+	ioDriverStrenghtSchema    = DefaultSchema.Register("", IoDriverStrenghtConfiguration)
+	timeOutSchema             = DefaultSchema.Register("", TimeOut)
+	pllParameterSchema        = DefaultSchema.Register("", PLL0Parameter)
+	orderedClockMonitorSchema = DefaultSchema.Register("", OrderedClockMonitor)
+	pllDividerSchema          = DefaultSchema.Register("", Pll0Divider)
+	clockOrderControlSchema   = DefaultSchema.Register("", ClockOrderControl0)
+	freqSweepControlSchema    = DefaultSchema.Register("", FrequencySweepControl1)
+	nonceReturnedTOSchema     = DefaultSchema.Register("", NonceReturnedTimeout)
+	bm1387MiscControlSchema   = DefaultSchema.Register(BM1387.Name, BM1387MiscControl)
+
+	clockDelayCtrlSchema     = DefaultSchema.CoreRegister(ClockDelayCtrl)
+	processMonitorCtrlSchema = DefaultSchema.CoreRegister(ProcessMonitorCtrl)
+	processMonitorDataSchema = DefaultSchema.CoreRegister(ProcessMonitorData)
+	coreErrorSchema          = DefaultSchema.CoreRegister(CoreError)
+	coreEnableSchema         = DefaultSchema.CoreRegister(CoreEnable)
+	hashClockCtrlSchema      = DefaultSchema.CoreRegister(HashClockCtrl)
+	hashClockCounterSchema   = DefaultSchema.CoreRegister(HashClockCounter)
+	sweepClockCtrlSchema     = DefaultSchema.CoreRegister(SweepClockCtrl)
+)
+
+// get returns the value of the named field in regVal.
+func (r *RegisterSchema) get(regVal uint32, name string) uint32 {
+	f := r.Field(name)
+	return bitsOf(regVal, f.Hi, f.Lo)
+}
+
+func (r *RegisterSchema) is(regVal uint32, name string) bool {
+	return r.get(regVal, name) == 1
+}
+
+// put returns val at the place of the named field.
+func (r *RegisterSchema) put(name string, val uint32) uint32 {
+	f := r.Field(name)
+	return putBits(val, f.Hi, f.Lo)
+}
+
+func (r *RegisterSchema) putBool(name string, set bool) uint32 {
+	if set {
+		return r.put(name, 1)
+	}
+	return 0
+}
+
+// reserved returns the bits of regVal no field describes.
+func (r *RegisterSchema) reserved(regVal uint32) uint32 {
+	return regVal &^ r.fieldsMask()
+}
+
+type ChipAddressReg struct {
+	ChipID  uint16 // CHIP_ID
+	CoreNum byte   // CORE_NUM
+	Addr    byte   // ADDR
+}
+
+func (r *ChipAddressReg) Decode(regVal uint32) {
+	s := chipAddressSchema
+	r.ChipID = uint16(s.get(regVal, "CHIP_ID"))
+	r.CoreNum = byte(s.get(regVal, "CORE_NUM"))
+	r.Addr = byte(s.get(regVal, "ADDR"))
+}
+
+func (r *ChipAddressReg) Encode() uint32 {
+	s := chipAddressSchema
+	return s.put("CHIP_ID", uint32(r.ChipID)) | s.put("CORE_NUM", uint32(r.CoreNum)) | s.put("ADDR", uint32(r.Addr))
+}
+
+type HashRateReg struct {
+	Long     bool   // LONG
+	HashRate uint32 // HASHRATE
+}
+
+func (r *HashRateReg) Decode(regVal uint32) {
+	s := hashRateSchema
+	r.Long = s.is(regVal, "LONG")
+	r.HashRate = s.get(regVal, "HASHRATE")
+}
+
+func (r *HashRateReg) Encode() uint32 {
+	s := hashRateSchema
+	return s.putBool("LONG", r.Long) | s.put("HASHRATE", r.HashRate)
+}
+
+type ChipNonceOffsetReg struct {
+	CNOV     bool   // CNOV
+	CNO      uint16 // CNO
+	reserved uint32
+}
+
+func (r *ChipNonceOffsetReg) Decode(regVal uint32) {
+	s := chipNonceOffsetSchema
+	r.CNOV = s.is(regVal, "CNOV")
+	r.CNO = uint16(s.get(regVal, "CNO"))
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *ChipNonceOffsetReg) Encode() uint32 {
+	s := chipNonceOffsetSchema
+	return r.reserved | s.putBool("CNOV", r.CNOV) | s.put("CNO", uint32(r.CNO))
+}
+
+var ticketMaskFields = [4]string{"TM0", "TM1", "TM2", "TM3"}
+
+type TicketMaskReg struct {
+	TM [4]byte // TM0 to TM3
+}
+
+func (r *TicketMaskReg) Decode(regVal uint32) {
+	for i, name := range ticketMaskFields {
+		r.TM[i] = byte(ticketMaskSchema.get(regVal, name))
+	}
+}
+
+func (r *TicketMaskReg) Encode() uint32 {
+	var regVal uint32
+	for i, name := range ticketMaskFields {
+		regVal |= ticketMaskSchema.put(name, uint32(r.TM[i]))
+	}
+	return regVal
+}
+
+// Difficulty of the nonces sent back, every bit set in the mask doubles it.
+func (r *TicketMaskReg) Difficulty() uint64 {
+	difficulty := uint64(1)
+	for _, tm := range r.TM {
+		for ; tm != 0; tm >>= 1 {
+			if tm&0x01 == 1 {
+				difficulty <<= 1
+			}
+		}
+	}
+	return difficulty
+}
+
+type MiscControlReg struct {
+	BT8D           uint16 // BT8D_8_5 and BT8D_4_0, uart divider
+	CoreSRST       bool   // CORE_SRST
+	SpatNOD        bool   // SPAT_NOD
+	RVSK0          bool   // RVS_K0
+	DSClkSel       byte   // DSCLK_SEL
+	TopClkSel      bool   // TOPCLK_SEL
+	BClkSel        bool   // BCLK_SEL, uart clock from PLL3 instead of CLKI
+	RetErrNonce    bool   // RET_ERR_NONCE
+	RFS            bool   // RFS
+	InvClkO        bool   // INV_CLKO
+	RetWorkErrFlag bool   // RET_WORK_ERR_FLAG
+	TFS            byte   // TFS
+	HashrateTWS    byte   // HASHRATE_TWS
+	reserved       uint32
+}
+
+func (r *MiscControlReg) Decode(regVal uint32) {
+	s := miscControlSchema
+	r.BT8D = uint16(s.get(regVal, "BT8D_8_5")<<5 | s.get(regVal, "BT8D_4_0"))
+	r.CoreSRST = s.is(regVal, "CORE_SRST")
+	r.SpatNOD = s.is(regVal, "SPAT_NOD")
+	r.RVSK0 = s.is(regVal, "RVS_K0")
+	r.DSClkSel = byte(s.get(regVal, "DSCLK_SEL"))
+	r.TopClkSel = s.is(regVal, "TOPCLK_SEL")
+	r.BClkSel = s.is(regVal, "BCLK_SEL")
+	r.RetErrNonce = s.is(regVal, "RET_ERR_NONCE")
+	r.RFS = s.is(regVal, "RFS")
+	r.InvClkO = s.is(regVal, "INV_CLKO")
+	r.RetWorkErrFlag = s.is(regVal, "RET_WORK_ERR_FLAG")
+	r.TFS = byte(s.get(regVal, "TFS"))
+	r.HashrateTWS = byte(s.get(regVal, "HASHRATE_TWS"))
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *MiscControlReg) Encode() uint32 {
+	s := miscControlSchema
+	return r.reserved |
+		s.put("BT8D_8_5", uint32(r.BT8D)>>5) |
+		s.putBool("CORE_SRST", r.CoreSRST) |
+		s.putBool("SPAT_NOD", r.SpatNOD) |
+		s.putBool("RVS_K0", r.RVSK0) |
+		s.put("DSCLK_SEL", uint32(r.DSClkSel)) |
+		s.putBool("TOPCLK_SEL", r.TopClkSel) |
+		s.putBool("BCLK_SEL", r.BClkSel) |
+		s.putBool("RET_ERR_NONCE", r.RetErrNonce) |
+		s.putBool("RFS", r.RFS) |
+		s.putBool("INV_CLKO", r.InvClkO) |
+		s.put("BT8D_4_0", uint32(r.BT8D)) |
+		s.putBool("RET_WORK_ERR_FLAG", r.RetWorkErrFlag) |
+		s.put("TFS", uint32(r.TFS)) |
+		s.put("HASHRATE_TWS", uint32(r.HashrateTWS))
+}
+
+type I2CControlReg struct {
+	Busy     bool // BUSY
+	Flags    byte // SOME_FLAGS
+	DoCmd    bool // DO_CMD
+	I2CAddr  byte // I2C_ADDR
+	RdWr     bool // RD#_WR
+	RegAddr  byte // I2C_REG_ADDR
+	RegVal   byte // I2C_REG_VAL
+	reserved uint32
+}
+
+func (r *I2CControlReg) Decode(regVal uint32) {
+	s := i2cControlSchema
+	r.Busy = s.is(regVal, "BUSY")
+	r.Flags = byte(s.get(regVal, "SOME_FLAGS"))
+	r.DoCmd = s.is(regVal, "DO_CMD")
+	r.I2CAddr = byte(s.get(regVal, "I2C_ADDR"))
+	r.RdWr = s.is(regVal, "RD#_WR")
+	r.RegAddr = byte(s.get(regVal, "I2C_REG_ADDR"))
+	r.RegVal = byte(s.get(regVal, "I2C_REG_VAL"))
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *I2CControlReg) Encode() uint32 {
+	s := i2cControlSchema
+	return r.reserved |
+		s.putBool("BUSY", r.Busy) |
+		s.put("SOME_FLAGS", uint32(r.Flags)) |
+		s.putBool("DO_CMD", r.DoCmd) |
+		s.put("I2C_ADDR", uint32(r.I2CAddr)) |
+		s.putBool("RD#_WR", r.RdWr) |
+		s.put("I2C_REG_ADDR", uint32(r.RegAddr)) |
+		s.put("I2C_REG_VAL", uint32(r.RegVal))
+}
+
+type OrderedClockEnableReg struct {
+	ClkEn    uint16 // CLKEN
+	reserved uint32
+}
+
+func (r *OrderedClockEnableReg) Decode(regVal uint32) {
+	r.ClkEn = uint16(orderedClockEnableSchema.get(regVal, "CLKEN"))
+	r.reserved = orderedClockEnableSchema.reserved(regVal)
+}
+
+func (r *OrderedClockEnableReg) Encode() uint32 {
+	return r.reserved | orderedClockEnableSchema.put("CLKEN", uint32(r.ClkEn))
+}
+
+type FastUARTConfigReg struct {
+	Div4OddSet  byte // DIV4_ODDSET
+	PLL3Div4    byte // PLL3_DIV4, fast uart clock is PLL3 / (PLL3Div4 + 1)
+	USrcOddSet  byte // USRC_ODDSET
+	USrcDiv     byte // USRC_DIV
+	ForceCoreEn bool // ForceCoreEn
+	ClkOSel     bool // CLKO_SEL
+	ClkOOddSet  byte // CLKO_ODDSET
+	ClkODiv     byte // CLKO_DIV
+	reserved    uint32
+}
+
+func (r *FastUARTConfigReg) Decode(regVal uint32) {
+	s := fastUARTConfigSchema
+	r.Div4OddSet = byte(s.get(regVal, "DIV4_ODDSET"))
+	r.PLL3Div4 = byte(s.get(regVal, "PLL3_DIV4"))
+	r.USrcOddSet = byte(s.get(regVal, "USRC_ODDSET"))
+	r.USrcDiv = byte(s.get(regVal, "USRC_DIV"))
+	r.ForceCoreEn = s.is(regVal, "ForceCoreEn")
+	r.ClkOSel = s.is(regVal, "CLKO_SEL")
+	r.ClkOOddSet = byte(s.get(regVal, "CLKO_ODDSET"))
+	r.ClkODiv = byte(s.get(regVal, "CLKO_DIV"))
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *FastUARTConfigReg) Encode() uint32 {
+	s := fastUARTConfigSchema
+	return r.reserved |
+		s.put("DIV4_ODDSET", uint32(r.Div4OddSet)) |
+		s.put("PLL3_DIV4", uint32(r.PLL3Div4)) |
+		s.put("USRC_ODDSET", uint32(r.USrcOddSet)) |
+		s.put("USRC_DIV", uint32(r.USrcDiv)) |
+		s.putBool("ForceCoreEn", r.ForceCoreEn) |
+		s.putBool("CLKO_SEL", r.ClkOSel) |
+		s.put("CLKO_ODDSET", uint32(r.ClkOOddSet)) |
+		s.put("CLKO_DIV", uint32(r.ClkODiv))
+}
+
+type UARTRelayReg struct {
+	GapCnt    uint16 // GAP_CNT
+	RORelayEn bool   // RO_RELAY_EN
+	CORelayEn bool   // CO_RELAY_EN
+	reserved  uint32
+}
+
+func (r *UARTRelayReg) Decode(regVal uint32) {
+	s := uartRelaySchema
+	r.GapCnt = uint16(s.get(regVal, "GAP_CNT"))
+	r.RORelayEn = s.is(regVal, "RO_RELAY_EN")
+	r.CORelayEn = s.is(regVal, "CO_RELAY_EN")
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *UARTRelayReg) Encode() uint32 {
+	s := uartRelaySchema
+	return r.reserved | s.put("GAP_CNT", uint32(r.GapCnt)) | s.putBool("RO_RELAY_EN", r.RORelayEn) | s.putBool("CO_RELAY_EN", r.CORelayEn)
+}
+
+type CoreRegisterControlReg struct {
+	WriteMSB  bool      // WR_RD#_MSB, set along with Write
+	Write     bool      // WR_RD#_LSB, a read otherwise
+	CoreID    byte      // CORE_ID
+	CoreRegID CoreRegID // CORE_REG_ID
+	Value     byte      // CORE_REG_VAL, only meaningful on writes
+	reserved  uint32
+}
+
+func (r *CoreRegisterControlReg) Decode(regVal uint32) {
+	s := coreRegControlSchema
+	r.WriteMSB = s.is(regVal, "WR_RD#_MSB")
+	r.Write = s.is(regVal, "WR_RD#_LSB")
+	r.CoreID = byte(s.get(regVal, "CORE_ID"))
+	r.CoreRegID = CoreRegID(s.get(regVal, "CORE_REG_ID"))
+	r.Value = byte(s.get(regVal, "CORE_REG_VAL"))
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *CoreRegisterControlReg) Encode() uint32 {
+	s := coreRegControlSchema
+	return r.reserved |
+		s.putBool("WR_RD#_MSB", r.WriteMSB) |
+		s.put("CORE_ID", uint32(r.CoreID)) |
+		s.putBool("WR_RD#_LSB", r.Write) |
+		s.put("CORE_REG_ID", uint32(r.CoreRegID)) |
+		s.put("CORE_REG_VAL", uint32(r.Value))
+}
+
+type CoreRegisterValueReg struct {
+	CoreID uint16 // CORE_ID
+	Value  uint16 // CORE_REG_VAL
+}
+
+func (r *CoreRegisterValueReg) Decode(regVal uint32) {
+	r.CoreID = uint16(coreRegValueSchema.get(regVal, "CORE_ID"))
+	r.Value = uint16(coreRegValueSchema.get(regVal, "CORE_REG_VAL"))
+}
+
+func (r *CoreRegisterValueReg) Encode() uint32 {
+	return coreRegValueSchema.put("CORE_ID", uint32(r.CoreID)) | coreRegValueSchema.put("CORE_REG_VAL", uint32(r.Value))
+}
+
+type ExternalTemperatureSensorReg struct {
+	LocalTempAddr    byte // LOCAL_TEMP_ADDR
+	LocalTempData    byte // LOCAL_TEMP_DATA
+	ExternalTempAddr byte // EXTERNAL_TEMP_ADDR
+	ExternalTempData byte // EXTERNAL_TEMP_DATA
+}
+
+func (r *ExternalTemperatureSensorReg) Decode(regVal uint32) {
+	s := extTempSensorSchema
+	r.LocalTempAddr = byte(s.get(regVal, "LOCAL_TEMP_ADDR"))
+	r.LocalTempData = byte(s.get(regVal, "LOCAL_TEMP_DATA"))
+	r.ExternalTempAddr = byte(s.get(regVal, "EXTERNAL_TEMP_ADDR"))
+	r.ExternalTempData = byte(s.get(regVal, "EXTERNAL_TEMP_DATA"))
+}
+
+func (r *ExternalTemperatureSensorReg) Encode() uint32 {
+	s := extTempSensorSchema
+	return s.put("LOCAL_TEMP_ADDR", uint32(r.LocalTempAddr)) |
+		s.put("LOCAL_TEMP_DATA", uint32(r.LocalTempData)) |
+		s.put("EXTERNAL_TEMP_ADDR", uint32(r.ExternalTempAddr)) |
+		s.put("EXTERNAL_TEMP_DATA", uint32(r.ExternalTempData))
+}
+
+type ErrorFlagReg struct {
+	CmdErrCnt   byte // CMD_ERR_CNT
+	WorkErrCnt  byte // WORK_ERR_CNT
+	CoreRespErr byte // CORE_RESP_ERR
+	reserved    uint32
+}
+
+func (r *ErrorFlagReg) Decode(regVal uint32) {
+	s := errorFlagSchema
+	r.CmdErrCnt = byte(s.get(regVal, "CMD_ERR_CNT"))
+	r.WorkErrCnt = byte(s.get(regVal, "WORK_ERR_CNT"))
+	r.CoreRespErr = byte(s.get(regVal, "CORE_RESP_ERR"))
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *ErrorFlagReg) Encode() uint32 {
+	s := errorFlagSchema
+	return r.reserved | s.put("CMD_ERR_CNT", uint32(r.CmdErrCnt)) | s.put("WORK_ERR_CNT", uint32(r.WorkErrCnt)) | s.put("CORE_RESP_ERR", uint32(r.CoreRespErr))
+}
+
+type AnalogMuxControlReg struct {
+	DiodeVddMuxSel byte // DIODE_VDD_MUX_SEL
+	reserved       uint32
+}
+
+func (r *AnalogMuxControlReg) Decode(regVal uint32) {
+	r.DiodeVddMuxSel = byte(analogMuxControlSchema.get(regVal, "DIODE_VDD_MUX_SEL"))
+	r.reserved = analogMuxControlSchema.reserved(regVal)
+}
+
+func (r *AnalogMuxControlReg) Encode() uint32 {
+	return r.reserved | analogMuxControlSchema.put("DIODE_VDD_MUX_SEL", uint32(r.DiodeVddMuxSel))
+}
+
+type IoDriverStrenghtConfigReg struct {
+	RFDS     byte // RF_DS
+	D3RSDisa bool // D3RS_DISA
+	D2RSDisa bool // D2RS_DISA
+	D1RSDisa bool // D1RS_DISA
+	D0RSEn   bool // D0RS_EN
+	R0DS     byte // R0_DS
+	ClkODS   byte // CLKO_DS
+	NRstODS  byte // NRSTO_DS
+	BODS     byte // BO_DS
+	CODS     byte // CO_DS
+	reserved uint32
+}
+
+func (r *IoDriverStrenghtConfigReg) Decode(regVal uint32) {
+	s := ioDriverStrenghtSchema
+	r.RFDS = byte(s.get(regVal, "RF_DS"))
+	r.D3RSDisa = s.is(regVal, "D3RS_DISA")
+	r.D2RSDisa = s.is(regVal, "D2RS_DISA")
+	r.D1RSDisa = s.is(regVal, "D1RS_DISA")
+	r.D0RSEn = s.is(regVal, "D0RS_EN")
+	r.R0DS = byte(s.get(regVal, "R0_DS"))
+	r.ClkODS = byte(s.get(regVal, "CLKO_DS"))
+	r.NRstODS = byte(s.get(regVal, "NRSTO_DS"))
+	r.BODS = byte(s.get(regVal, "BO_DS"))
+	r.CODS = byte(s.get(regVal, "CO_DS"))
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *IoDriverStrenghtConfigReg) Encode() uint32 {
+	s := ioDriverStrenghtSchema
+	return r.reserved |
+		s.put("RF_DS", uint32(r.RFDS)) |
+		s.putBool("D3RS_DISA", r.D3RSDisa) |
+		s.putBool("D2RS_DISA", r.D2RSDisa) |
+		s.putBool("D1RS_DISA", r.D1RSDisa) |
+		s.putBool("D0RS_EN", r.D0RSEn) |
+		s.put("R0_DS", uint32(r.R0DS)) |
+		s.put("CLKO_DS", uint32(r.ClkODS)) |
+		s.put("NRSTO_DS", uint32(r.NRstODS)) |
+		s.put("BO_DS", uint32(r.BODS)) |
+		s.put("CO_DS", uint32(r.CODS))
+}
+
+type TimeOutReg struct {
+	TmOut    uint16 // TMOUT
+	reserved uint32
+}
+
+func (r *TimeOutReg) Decode(regVal uint32) {
+	r.TmOut = uint16(timeOutSchema.get(regVal, "TMOUT"))
+	r.reserved = timeOutSchema.reserved(regVal)
+}
+
+func (r *TimeOutReg) Encode() uint32 {
+	return r.reserved | timeOutSchema.put("TMOUT", uint32(r.TmOut))
+}
+
+// PLLParameterReg is the layout of PLL0 to PLL3 parameters, also fitting the
+// BM1387 single PLL which has no LOCKED nor PLLEN bits.
+type PLLParameterReg struct {
+	Locked   bool   // LOCKED
+	PLLEn    bool   // PLLEN
+	FBDiv    uint16 // FBDIV
+	RefDiv   byte   // REFDIV
+	PostDiv1 byte   // POSTDIV1
+	PostDiv2 byte   // POSTDIV2
+	reserved uint32
+}
+
+func (r *PLLParameterReg) Decode(regVal uint32) {
+	s := pllParameterSchema
+	r.Locked = s.is(regVal, "LOCKED")
+	r.PLLEn = s.is(regVal, "PLLEN")
+	r.FBDiv = uint16(s.get(regVal, "FBDIV"))
+	r.RefDiv = byte(s.get(regVal, "REFDIV"))
+	r.PostDiv1 = byte(s.get(regVal, "POSTDIV1"))
+	r.PostDiv2 = byte(s.get(regVal, "POSTDIV2"))
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *PLLParameterReg) Encode() uint32 {
+	s := pllParameterSchema
+	return r.reserved |
+		s.putBool("LOCKED", r.Locked) |
+		s.putBool("PLLEN", r.PLLEn) |
+		s.put("FBDIV", uint32(r.FBDiv)) |
+		s.put("REFDIV", uint32(r.RefDiv)) |
+		s.put("POSTDIV1", uint32(r.PostDiv1)) |
+		s.put("POSTDIV2", uint32(r.PostDiv2))
+}
+
+type OrderedClockMonitorReg struct {
+	Start    bool   // START
+	ClkSel   byte   // CLK_SEL
+	ClkCount uint16 // CLK_COUNT
+	reserved uint32
+}
+
+func (r *OrderedClockMonitorReg) Decode(regVal uint32) {
+	s := orderedClockMonitorSchema
+	r.Start = s.is(regVal, "START")
+	r.ClkSel = byte(s.get(regVal, "CLK_SEL"))
+	r.ClkCount = uint16(s.get(regVal, "CLK_COUNT"))
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *OrderedClockMonitorReg) Encode() uint32 {
+	s := orderedClockMonitorSchema
+	return r.reserved | s.putBool("START", r.Start) | s.put("CLK_SEL", uint32(r.ClkSel)) | s.put("CLK_COUNT", uint32(r.ClkCount))
+}
+
+var pllDividerFields = [4]string{"PLL_DIV0", "PLL_DIV1", "PLL_DIV2", "PLL_DIV3"}
+
+// PLLDividerReg is the layout of Pll0Divider to Pll3Divider.
+type PLLDividerReg struct {
+	Div      [4]byte // PLL_DIV0 to PLL_DIV3
+	reserved uint32
+}
+
+func (r *PLLDividerReg) Decode(regVal uint32) {
+	for i, name := range pllDividerFields {
+		r.Div[i] = byte(pllDividerSchema.get(regVal, name))
+	}
+	r.reserved = pllDividerSchema.reserved(regVal)
+}
+
+func (r *PLLDividerReg) Encode() uint32 {
+	regVal := r.reserved
+	for i, name := range pllDividerFields {
+		regVal |= pllDividerSchema.put(name, uint32(r.Div[i]))
+	}
+	return regVal
+}
+
+var clockSelFields = [8]string{"CLK0_SEL", "CLK1_SEL", "CLK2_SEL", "CLK3_SEL", "CLK4_SEL", "CLK5_SEL", "CLK6_SEL", "CLK7_SEL"}
+
+// ClockOrderControlReg is the layout of ClockOrderControl0 (CLK0 to CLK7) and
+// ClockOrderControl1 (CLK8 to CLK15).
+type ClockOrderControlReg struct {
+	ClkSel [8]byte // CLK0_SEL to CLK7_SEL of ClockOrderControl0
+}
+
+func (r *ClockOrderControlReg) Decode(regVal uint32) {
+	for i, name := range clockSelFields {
+		r.ClkSel[i] = byte(clockOrderControlSchema.get(regVal, name))
+	}
+}
+
+func (r *ClockOrderControlReg) Encode() uint32 {
+	var regVal uint32
+	for i, name := range clockSelFields {
+		regVal |= clockOrderControlSchema.put(name, uint32(r.ClkSel[i]))
+	}
+	return regVal
+}
+
+type FrequencySweepControlReg struct {
+	SweepState            byte // SWEEP_STATE
+	SweepStAddr           byte // SWEEP_ST_ADDR
+	AllCoreClkSelChangeSt bool // ALL_CORE_CLK_SEL_CHANGE_ST
+	SweepFailLockEn       bool // SWEEP_FAIL_LOCK_EN
+	SweepReset            bool // SWEEP_RESET
+	CurrPatAddr           byte // CURR_PAT_ADDR
+	SwpOnePatDone         bool // SWP_ONE_PAT_DONE
+	SwpPatAddr            byte // SWP_PAT_ADDR
+	SwpDoneAll            bool // SWP_DONE_ALL
+	SwpOngoing            bool // SWP_ONGOING
+	SwpTrig               bool // SWP_TRIG
+	SwpEn                 bool // SWP_EN
+	reserved              uint32
+}
+
+func (r *FrequencySweepControlReg) Decode(regVal uint32) {
+	s := freqSweepControlSchema
+	r.SweepState = byte(s.get(regVal, "SWEEP_STATE"))
+	r.SweepStAddr = byte(s.get(regVal, "SWEEP_ST_ADDR"))
+	r.AllCoreClkSelChangeSt = s.is(regVal, "ALL_CORE_CLK_SEL_CHANGE_ST")
+	r.SweepFailLockEn = s.is(regVal, "SWEEP_FAIL_LOCK_EN")
+	r.SweepReset = s.is(regVal, "SWEEP_RESET")
+	r.CurrPatAddr = byte(s.get(regVal, "CURR_PAT_ADDR"))
+	r.SwpOnePatDone = s.is(regVal, "SWP_ONE_PAT_DONE")
+	r.SwpPatAddr = byte(s.get(regVal, "SWP_PAT_ADDR"))
+	r.SwpDoneAll = s.is(regVal, "SWP_DONE_ALL")
+	r.SwpOngoing = s.is(regVal, "SWP_ONGOING")
+	r.SwpTrig = s.is(regVal, "SWP_TRIG")
+	r.SwpEn = s.is(regVal, "SWP_EN")
+	r.reserved = s.reserved(regVal)
+}
+
+func (r *FrequencySweepControlReg) Encode() uint32 {
+	s := freqSweepControlSchema
+	return r.reserved |
+		s.put("SWEEP_STATE", uint32(r.SweepState)) |
+		s.put("SWEEP_ST_ADDR", uint32(r.SweepStAddr)) |
+		s.putBool("ALL_CORE_CLK_SEL_CHANGE_ST", r.AllCoreClkSelChangeSt) |
+		s.putBool("SWEEP_FAIL_LOCK_EN", r.SweepFailLockEn) |
+		s.putBool("SWEEP_RESET", r.SweepReset) |
+		s.put("CURR_PAT_ADDR", uint32(r.CurrPatAddr)) |
+		s.putBool("SWP_ONE_PAT_DONE", r.SwpOnePatDone) |
+		s.put("SWP_PAT_ADDR", uint32(r.SwpPatAddr)) |
+		s.putBool("SWP_DONE_ALL", r.SwpDoneAll) |
+		s.putBool("SWP_ONGOING", r.SwpOngoing) |
+		s.putBool("SWP_TRIG", r.SwpTrig) |
+		s.putBool("SWP_EN", r.SwpEn)
+}
+
+type NonceReturnedTimeoutReg struct {
+	SweepTimeout uint16 // SWEEP_TIMEOUT
+	reserved     uint32
+}
+
+func (r *NonceReturnedTimeoutReg) Decode(regVal uint32) {
+	r.SweepTimeout = uint16(nonceReturnedTOSchema.get(regVal, "SWEEP_TIMEOUT"))
+	r.reserved = nonceReturnedTOSchema.reserved(regVal)
+}
+
+func (r *NonceReturnedTimeoutReg) Encode() uint32 {
+	return r.reserved | nonceReturnedTOSchema.put("SWEEP_TIMEOUT", uint32(r.SweepTimeout))
+}
+
+type BM1387MiscControlReg struct {
+	BT8D     byte // BT8D, baud = CLKI / ((BT8D + 1) * 8)
+	reserved uint32
+}
+
+func (r *BM1387MiscControlReg) Decode(regVal uint32) {
+	r.BT8D = byte(bm1387MiscControlSchema.get(regVal, "BT8D"))
+	r.reserved = bm1387MiscControlSchema.reserved(regVal)
+}
+
+func (r *BM1387MiscControlReg) Encode() uint32 {
+	return r.reserved | bm1387MiscControlSchema.put("BT8D", uint32(r.BT8D))
+}
+
+// CoreRegister is the typed view of a core register value.
+type CoreRegister interface {
+	Decode(val uint16)
+	Encode() uint16
+}
+
+type ClockDelayCtrlReg struct {
+	CCDlySel  byte // CCDLY_SEL
+	PWTHSel   byte // PWTH_SEL
+	HashClkEn bool // HASH_CLKEN
+	MMEn      bool // MMEN
+	SwpfMode  bool // SWPF_MODE
+	reserved  uint16
+}
+
+func (r *ClockDelayCtrlReg) Decode(val uint16) {
+	s, regVal := clockDelayCtrlSchema, uint32(val)
+	r.CCDlySel = byte(s.get(regVal, "CCDLY_SEL"))
+	r.PWTHSel = byte(s.get(regVal, "PWTH_SEL"))
+	r.HashClkEn = s.is(regVal, "HASH_CLKEN")
+	r.MMEn = s.is(regVal, "MMEN")
+	r.SwpfMode = s.is(regVal, "SWPF_MODE")
+	r.reserved = uint16(s.reserved(regVal))
+}
+
+func (r *ClockDelayCtrlReg) Encode() uint16 {
+	s := clockDelayCtrlSchema
+	return r.reserved | uint16(s.put("CCDLY_SEL", uint32(r.CCDlySel))|
+		s.put("PWTH_SEL", uint32(r.PWTHSel))|
+		s.putBool("HASH_CLKEN", r.HashClkEn)|
+		s.putBool("MMEN", r.MMEn)|
+		s.putBool("SWPF_MODE", r.SwpfMode))
+}
+
+type ProcessMonitorCtrlReg struct {
+	PMStart  bool // PM_START
+	PMSel    byte // PM_SEL
+	reserved uint16
+}
+
+func (r *ProcessMonitorCtrlReg) Decode(val uint16) {
+	s, regVal := processMonitorCtrlSchema, uint32(val)
+	r.PMStart = s.is(regVal, "PM_START")
+	r.PMSel = byte(s.get(regVal, "PM_SEL"))
+	r.reserved = uint16(s.reserved(regVal))
+}
+
+func (r *ProcessMonitorCtrlReg) Encode() uint16 {
+	s := processMonitorCtrlSchema
+	return r.reserved | uint16(s.putBool("PM_START", r.PMStart)|s.put("PM_SEL", uint32(r.PMSel)))
+}
+
+type ProcessMonitorDataReg struct {
+	FreqCnt uint16 // FREQ_CNT
+}
+
+func (r *ProcessMonitorDataReg) Decode(val uint16) {
+	r.FreqCnt = uint16(processMonitorDataSchema.get(uint32(val), "FREQ_CNT"))
+}
+
+func (r *ProcessMonitorDataReg) Encode() uint16 {
+	return uint16(processMonitorDataSchema.put("FREQ_CNT", uint32(r.FreqCnt)))
+}
+
+type CoreErrorReg struct {
+	IniNonceErr bool // INI_NONCE_ERR
+	CmdErrCnt   byte // CMD_ERR_CNT
+	reserved    uint16
+}
+
+func (r *CoreErrorReg) Decode(val uint16) {
+	s, regVal := coreErrorSchema, uint32(val)
+	r.IniNonceErr = s.is(regVal, "INI_NONCE_ERR")
+	r.CmdErrCnt = byte(s.get(regVal, "CMD_ERR_CNT"))
+	r.reserved = uint16(s.reserved(regVal))
+}
+
+func (r *CoreErrorReg) Encode() uint16 {
+	s := coreErrorSchema
+	return r.reserved | uint16(s.putBool("INI_NONCE_ERR", r.IniNonceErr)|s.put("CMD_ERR_CNT", uint32(r.CmdErrCnt)))
+}
+
+type CoreEnableReg struct {
+	CoreEnI  byte // CORE_EN_I
+	reserved uint16
+}
+
+func (r *CoreEnableReg) Decode(val uint16) {
+	r.CoreEnI = byte(coreEnableSchema.get(uint32(val), "CORE_EN_I"))
+	r.reserved = uint16(coreEnableSchema.reserved(uint32(val)))
+}
+
+func (r *CoreEnableReg) Encode() uint16 {
+	return r.reserved | uint16(coreEnableSchema.put("CORE_EN_I", uint32(r.CoreEnI)))
+}
+
+type HashClockCtrlReg struct {
+	ClockCtrl byte // CLOCK_CTRL
+	reserved  uint16
+}
+
+func (r *HashClockCtrlReg) Decode(val uint16) {
+	r.ClockCtrl = byte(hashClockCtrlSchema.get(uint32(val), "CLOCK_CTRL"))
+	r.reserved = uint16(hashClockCtrlSchema.reserved(uint32(val)))
+}
+
+func (r *HashClockCtrlReg) Encode() uint16 {
+	return r.reserved | uint16(hashClockCtrlSchema.put("CLOCK_CTRL", uint32(r.ClockCtrl)))
+}
+
+type HashClockCounterReg struct {
+	ClockCnt byte // CLOCK_CNT
+	reserved uint16
+}
+
+func (r *HashClockCounterReg) Decode(val uint16) {
+	r.ClockCnt = byte(hashClockCounterSchema.get(uint32(val), "CLOCK_CNT"))
+	r.reserved = uint16(hashClockCounterSchema.reserved(uint32(val)))
+}
+
+func (r *HashClockCounterReg) Encode() uint16 {
+	return r.reserved | uint16(hashClockCounterSchema.put("CLOCK_CNT", uint32(r.ClockCnt)))
+}
+
+type SweepClockCtrlReg struct {
+	SwpfMode bool // SWPF_MODE
+	ClkSel   byte // CLK_SEL
+	reserved uint16
+}
+
+func (r *SweepClockCtrlReg) Decode(val uint16) {
+	s, regVal := sweepClockCtrlSchema, uint32(val)
+	r.SwpfMode = s.is(regVal, "SWPF_MODE")
+	r.ClkSel = byte(s.get(regVal, "CLK_SEL"))
+	r.reserved = uint16(s.reserved(regVal))
+}
+
+func (r *SweepClockCtrlReg) Encode() uint16 {
+	s := sweepClockCtrlSchema
+	return r.reserved | uint16(s.putBool("SWPF_MODE", r.SwpfMode)|s.put("CLK_SEL", uint32(r.ClkSel)))
+}
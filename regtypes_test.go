@@ -0,0 +1,161 @@
+package bm13xx
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRegister_Decode(t *testing.T) {
+	tests := []struct {
+		name   string
+		regVal uint32
+		reg    Register
+		want   Register
+	}{
+		{
+			name:   "MiscControl gekko",
+			regVal: 0x00006131,
+			reg:    &MiscControlReg{},
+			want:   &MiscControlReg{BT8D: 1, RFS: true, InvClkO: true, TFS: 3, HashrateTWS: 1},
+		},
+		{
+			name:   "MiscControl fast uart",
+			regVal: 0x01013A01,
+			reg:    &MiscControlReg{},
+			want:   &MiscControlReg{BT8D: 0x3A, BClkSel: true, InvClkO: true, HashrateTWS: 1},
+		},
+		{
+			name:   "PLL3Parameter",
+			regVal: 0xC0700111,
+			reg:    &PLLParameterReg{},
+			want:   &PLLParameterReg{Locked: true, PLLEn: true, FBDiv: 112, RefDiv: 1, PostDiv1: 1, PostDiv2: 1},
+		},
+		{
+			name:   "FastUARTConfiguration",
+			regVal: 0x0600000F,
+			reg:    &FastUARTConfigReg{},
+			want:   &FastUARTConfigReg{PLL3Div4: 6, ClkODiv: 15},
+		},
+		{
+			name:   "TicketMask",
+			regVal: 0x000000F0,
+			reg:    &TicketMaskReg{},
+			want:   &TicketMaskReg{TM: [4]byte{0xF0, 0, 0, 0}},
+		},
+		{
+			name:   "ErrorFlag",
+			regVal: 0x12340056,
+			reg:    &ErrorFlagReg{},
+			want:   &ErrorFlagReg{CmdErrCnt: 0x12, WorkErrCnt: 0x34, CoreRespErr: 0x56},
+		},
+		{
+			name:   "CoreRegisterControl write",
+			regVal: 0x80008074,
+			reg:    &CoreRegisterControlReg{},
+			want:   &CoreRegisterControlReg{WriteMSB: true, Write: true, Value: 0x74},
+		},
+		{
+			name:   "BM1387MiscControl",
+			regVal: 0x40201A00,
+			reg:    &BM1387MiscControlReg{},
+			want:   &BM1387MiscControlReg{BT8D: 26, reserved: 0x40200000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.reg.Decode(tt.regVal)
+			if !cmp.Equal(tt.reg, tt.want, cmp.Exporter(func(reflect.Type) bool { return true })) {
+				t.Errorf("Decode(0x%08X) = %+v, want %+v", tt.regVal, tt.reg, tt.want)
+			}
+			if got := tt.reg.Encode(); got != tt.regVal {
+				t.Errorf("Encode() = 0x%08X, want 0x%08X", got, tt.regVal)
+			}
+		})
+	}
+}
+
+func TestTicketMaskReg_Difficulty(t *testing.T) {
+	tests := []struct {
+		regVal uint32
+		want   uint64
+	}{
+		{0x00000000, 1},
+		{0x000000F0, 16},
+		{0x0000FFFF, 65536},
+	}
+	for _, tt := range tests {
+		var r TicketMaskReg
+		r.Decode(tt.regVal)
+		if got := r.Difficulty(); got != tt.want {
+			t.Errorf("TicketMaskReg(0x%08X).Difficulty() = %d, want %d", tt.regVal, got, tt.want)
+		}
+	}
+}
+
+func TestCoreRegister_Decode(t *testing.T) {
+	tests := []struct {
+		name string
+		val  uint16
+		reg  CoreRegister
+		want CoreRegister
+	}{
+		{
+			name: "ClockDelayCtrl gekko",
+			val:  0x0074,
+			reg:  &ClockDelayCtrlReg{},
+			want: &ClockDelayCtrlReg{CCDlySel: 1, PWTHSel: 3, MMEn: true},
+		},
+		{
+			name: "ClockDelayCtrl hash clock",
+			val:  0x007C,
+			reg:  &ClockDelayCtrlReg{},
+			want: &ClockDelayCtrlReg{CCDlySel: 1, PWTHSel: 3, HashClkEn: true, MMEn: true},
+		},
+		{
+			name: "CoreError",
+			val:  0x0013,
+			reg:  &CoreErrorReg{},
+			want: &CoreErrorReg{IniNonceErr: true, CmdErrCnt: 3},
+		},
+		{
+			name: "SweepClockCtrl",
+			val:  0x0085,
+			reg:  &SweepClockCtrlReg{},
+			want: &SweepClockCtrlReg{SwpfMode: true, ClkSel: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.reg.Decode(tt.val)
+			if !cmp.Equal(tt.reg, tt.want, cmp.Exporter(func(reflect.Type) bool { return true })) {
+				t.Errorf("Decode(0x%04X) = %+v, want %+v", tt.val, tt.reg, tt.want)
+			}
+			if got := tt.reg.Encode(); got != tt.val {
+				t.Errorf("Encode() = 0x%04X, want 0x%04X", got, tt.val)
+			}
+		})
+	}
+}
+
+func TestRegister_roundTrip(t *testing.T) {
+	regs := []Register{&ChipAddressReg{}, &HashRateReg{}, &ChipNonceOffsetReg{}, &TicketMaskReg{},
+		&MiscControlReg{}, &I2CControlReg{}, &OrderedClockEnableReg{}, &FastUARTConfigReg{}, &UARTRelayReg{},
+		&CoreRegisterControlReg{}, &CoreRegisterValueReg{}, &ExternalTemperatureSensorReg{}, &ErrorFlagReg{},
+		&AnalogMuxControlReg{}, &IoDriverStrenghtConfigReg{}, &TimeOutReg{}, &PLLParameterReg{},
+		&OrderedClockMonitorReg{}, &PLLDividerReg{}, &ClockOrderControlReg{}, &FrequencySweepControlReg{},
+		&NonceReturnedTimeoutReg{}, &BM1387MiscControlReg{}}
+	for _, reg := range regs {
+		for bit := 0; bit <= 32; bit++ {
+			regVal := uint32(1) << bit
+			if bit == 32 {
+				regVal = 0xffffffff
+			}
+			reg.Decode(regVal)
+			if got := reg.Encode(); got != regVal {
+				t.Errorf("%T Encode(Decode(0x%08X)) = 0x%08X", reg, regVal, got)
+			}
+		}
+	}
+}
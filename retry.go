@@ -0,0 +1,46 @@
+package bm13xx
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy tells how register and core register reads are retried.
+// The zero value makes a single attempt.
+type RetryPolicy struct {
+	Attempts int           // attempts in total, including the first one
+	Backoff  time.Duration // wait before the first retry, doubled for every next one
+	// Retryable tells which errors are worth another attempt,
+	// if nil line glitches are: ErrCRC, ErrShortFrame and ErrTimeout.
+	Retryable func(error) bool
+}
+
+func isLineGlitch(err error) bool {
+	return errors.Is(err, ErrCRC) || errors.Is(err, ErrShortFrame) || errors.Is(err, ErrTimeout)
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return isLineGlitch(err)
+}
+
+// retry runs attempt according to the chain retry policy.
+func (c *Chain) retry(ctx context.Context, attempt func() error) error {
+	backoff := c.Retry.Backoff
+	for i := 1; ; i++ {
+		err := attempt()
+		if err == nil || i >= c.Retry.Attempts || !c.Retry.retryable(err) {
+			return err
+		}
+		c.disp.mu.Lock()
+		c.disp.retries++
+		c.disp.mu.Unlock()
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,418 @@
+package bm13xx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Access tells what software can do with a register or a field.
+type Access string
+
+const (
+	ReadWrite    Access = "rw"
+	ReadOnly     Access = "ro"
+	WriteOnly    Access = "wo"
+	SelfClearing Access = "sc"      // written to 1, back to 0 once the chip is done
+	Unknown      Access = "unknown" // of a field of unknown use, dumped but kept as reserved
+)
+
+// FieldSchema is a bit range of a register, BIT[Hi:Lo].
+type FieldSchema struct {
+	Name   string
+	Hi, Lo uint
+	Access Access // the register one if empty
+}
+
+// RegisterSchema describes a register layout.
+type RegisterSchema struct {
+	Name   string            `json:"name"`
+	Addr   RegAddr           `json:"addr"` // CoreRegID of a core register
+	Access Access            `json:"access"`
+	Reset  uint32            `json:"reset"`
+	Models []string          `json:"models,omitempty"` // every model if empty
+	Fields []FieldSchema     `json:"fields,omitempty"` // from the most significant, the gaps are reserved
+	Label  string            `json:"label,omitempty"`  // title of text dumps, Name if empty
+	Dec    []string          `json:"dec,omitempty"`    // fields dumped in decimal, hexadecimal otherwise
+	Notes  map[string]string `json:"notes,omitempty"`  // text dumped after a field value
+	core   bool
+}
+
+// Schema describes the registers of the chip models.
+type Schema struct {
+	Registers     []RegisterSchema `json:"registers"`
+	CoreRegisters []RegisterSchema `json:"core_registers"`
+}
+
+// LoadSchema reads a JSON schema, for chips the built-in one does not know.
+func LoadSchema(r io.Reader) (*Schema, error) {
+	var s Schema
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	s.init()
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) init() {
+	for i := range s.CoreRegisters {
+		s.CoreRegisters[i].core = true
+	}
+}
+
+// Register returns the layout of a register on a model, nil if unknown.
+// A register dedicated to the model wins over a register of every model,
+// an empty model matches any register, those of every model first.
+func (s *Schema) Register(model string, addr RegAddr) *RegisterSchema {
+	var found *RegisterSchema
+	for i := range s.Registers {
+		r := &s.Registers[i]
+		if r.Addr != addr {
+			continue
+		}
+		if len(r.Models) == 0 {
+			if found == nil || model == "" {
+				found = r
+			}
+		} else if model == "" {
+			if found == nil {
+				found = r
+			}
+		} else if r.AppliesTo(model) {
+			return r
+		}
+	}
+	return found
+}
+
+// CoreRegister returns the layout of a core register, nil if unknown.
+func (s *Schema) CoreRegister(id CoreRegID) *RegisterSchema {
+	for i := range s.CoreRegisters {
+		if s.CoreRegisters[i].Addr == RegAddr(id) {
+			return &s.CoreRegisters[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks the fields fit their register without overlapping, and a model
+// does not get two registers at the same address.
+func (s *Schema) Validate() error {
+	for i := range s.Registers {
+		if err := s.Registers[i].validate(); err != nil {
+			return err
+		}
+		for j := 0; j < i; j++ {
+			if s.Registers[j].Addr == s.Registers[i].Addr && s.Registers[j].overlaps(&s.Registers[i]) {
+				return fmt.Errorf("%s and %s share address 0x%02X", s.Registers[j].Name, s.Registers[i].Name, byte(s.Registers[i].Addr))
+			}
+		}
+	}
+	for i := range s.CoreRegisters {
+		if err := s.CoreRegisters[i].validate(); err != nil {
+			return err
+		}
+		for j := 0; j < i; j++ {
+			if s.CoreRegisters[j].Addr == s.CoreRegisters[i].Addr {
+				return fmt.Errorf("%s and %s share core register ID %d", s.CoreRegisters[j].Name, s.CoreRegisters[i].Name, byte(s.CoreRegisters[i].Addr))
+			}
+		}
+	}
+	return nil
+}
+
+func (r *RegisterSchema) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("register 0x%02X without name", byte(r.Addr))
+	}
+	if err := r.Access.validate(); err != nil || r.Access == "" {
+		return fmt.Errorf("%s access %q invalid", r.Name, r.Access)
+	}
+	if r.Reset&^r.sizeMask() != 0 {
+		return fmt.Errorf("%s reset 0x%08X wider than the register", r.Name, r.Reset)
+	}
+	var used uint32
+	for _, f := range r.Fields {
+		if f.Hi < f.Lo || f.Hi >= r.size() {
+			return fmt.Errorf("%s.%s BIT[%d:%d] invalid", r.Name, f.Name, f.Hi, f.Lo)
+		}
+		if used&f.mask() != 0 {
+			return fmt.Errorf("%s.%s overlaps another field", r.Name, f.Name)
+		}
+		if err := f.Access.validate(); err != nil {
+			return fmt.Errorf("%s.%s %w", r.Name, f.Name, err)
+		}
+		used |= f.mask()
+	}
+	return nil
+}
+
+func (r *RegisterSchema) overlaps(o *RegisterSchema) bool {
+	if len(r.Models) == 0 || len(o.Models) == 0 {
+		return len(r.Models) == len(o.Models)
+	}
+	for _, m := range o.Models {
+		if r.AppliesTo(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Access) validate() error {
+	switch a {
+	case "", ReadWrite, ReadOnly, WriteOnly, SelfClearing, Unknown:
+		return nil
+	}
+	return fmt.Errorf("access %q invalid", a)
+}
+
+// AppliesTo tells if the register exists on a model.
+func (r *RegisterSchema) AppliesTo(model string) bool {
+	if len(r.Models) == 0 {
+		return true
+	}
+	for _, m := range r.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RegisterSchema) size() uint {
+	if r.core {
+		return 16
+	}
+	return 32
+}
+
+func (r *RegisterSchema) sizeMask() uint32 {
+	return 1<<r.size() - 1
+}
+
+func (f FieldSchema) mask() uint32 {
+	return putBits(0xffffffff, f.Hi, f.Lo)
+}
+
+// Bits returns the bit range, like "31:16" or "7".
+func (f FieldSchema) Bits() string {
+	if f.Hi == f.Lo {
+		return strconv.Itoa(int(f.Hi))
+	}
+	return strconv.Itoa(int(f.Hi)) + ":" + strconv.Itoa(int(f.Lo))
+}
+
+type fieldJSON struct {
+	Name   string `json:"name"`
+	Bits   string `json:"bits"`
+	Access Access `json:"access,omitempty"`
+}
+
+func (f FieldSchema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fieldJSON{Name: f.Name, Bits: f.Bits(), Access: f.Access})
+}
+
+func (f *FieldSchema) UnmarshalJSON(data []byte) error {
+	var fj fieldJSON
+	if err := json.Unmarshal(data, &fj); err != nil {
+		return err
+	}
+	hi, lo := fj.Bits, fj.Bits
+	if i := strings.IndexByte(fj.Bits, ':'); i >= 0 {
+		hi, lo = fj.Bits[:i], fj.Bits[i+1:]
+	}
+	h, err := strconv.ParseUint(hi, 10, 5)
+	if err != nil {
+		return fmt.Errorf("field %s bits %q: %w", fj.Name, fj.Bits, err)
+	}
+	l, err := strconv.ParseUint(lo, 10, 5)
+	if err != nil {
+		return fmt.Errorf("field %s bits %q: %w", fj.Name, fj.Bits, err)
+	}
+	*f = FieldSchema{Name: fj.Name, Hi: uint(h), Lo: uint(l), Access: fj.Access}
+	return nil
+}
+
+// FieldAccess returns the access of a field, inherited from the register if unset.
+func (r *RegisterSchema) FieldAccess(f FieldSchema) Access {
+	if f.Access != "" {
+		return f.Access
+	}
+	return r.Access
+}
+
+// Field returns the named field, nil if the register has none.
+func (r *RegisterSchema) Field(name string) *FieldSchema {
+	for i := range r.Fields {
+		if r.Fields[i].Name == name {
+			return &r.Fields[i]
+		}
+	}
+	return nil
+}
+
+// Mask returns the bits of the fields having one of the accesses.
+func (r *RegisterSchema) Mask(access ...Access) uint32 {
+	var mask uint32
+	for _, f := range r.Fields {
+		for _, a := range access {
+			if r.FieldAccess(f) == a {
+				mask |= f.mask()
+			}
+		}
+	}
+	return mask
+}
+
+// fieldsMask returns the bits of all the fields, the others are reserved.
+func (r *RegisterSchema) fieldsMask() uint32 {
+	var mask uint32
+	for _, f := range r.Fields {
+		if f.Access != Unknown {
+			mask |= f.mask()
+		}
+	}
+	return mask
+}
+
+// VerifyMask returns the bits a read back gives as written: the read-write fields,
+// the whole register if it has no field but can be read and written.
+func (r *RegisterSchema) VerifyMask() uint32 {
+	if len(r.Fields) == 0 {
+		if r.Access == ReadWrite {
+			return r.sizeMask()
+		}
+		return 0
+	}
+	return r.Mask(ReadWrite)
+}
+
+// Decode splits a value in its fields.
+func (r *RegisterSchema) Decode(val uint32) []Field {
+	fields := make([]Field, 0, len(r.Fields))
+	for _, f := range r.Fields {
+		fields = append(fields, Field{Name: f.Name, Bits: f.Bits(), Value: bitsOf(val, f.Hi, f.Lo)})
+	}
+	return fields
+}
+
+// Set returns val with a field changed.
+func (r *RegisterSchema) Set(val uint32, name string, fieldVal uint32) (uint32, error) {
+	f := r.Field(name)
+	if f == nil {
+		return val, fmt.Errorf("%s.%s %w", r.Name, name, ErrNotFound)
+	}
+	if fieldVal > bitsOf(0xffffffff, f.Hi-f.Lo, 0) {
+		return val, fmt.Errorf("%s.%s = 0x%X %w", r.Name, name, fieldVal, ErrOutOfRange)
+	}
+	return val&^f.mask() | putBits(fieldVal, f.Hi, f.Lo), nil
+}
+
+// Encode builds a value from the reset one and the given fields.
+func (r *RegisterSchema) Encode(fields map[string]uint32) (uint32, error) {
+	val := r.Reset
+	for name, fieldVal := range fields {
+		var err error
+		if val, err = r.Set(val, name, fieldVal); err != nil {
+			return 0, err
+		}
+	}
+	return val, nil
+}
+
+// Check tells if a value can be written: the reserved bits must keep their
+// reset value, a read-only register can not be written at all.
+func (r *RegisterSchema) Check(val uint32) error {
+	if r.Access == ReadOnly {
+		return fmt.Errorf("%s is read-only", r.Name)
+	}
+	fields := r.fieldsMask()
+	if len(r.Fields) == 0 {
+		fields = r.sizeMask()
+	}
+	if reserved := r.sizeMask() &^ fields; (val^r.Reset)&reserved != 0 || val&^r.sizeMask() != 0 {
+		return fmt.Errorf("%s = 0x%08X reserved bits %w", r.Name, val, ErrOutOfRange)
+	}
+	return nil
+}
+
+// Fprint writes a value and its fields to w, also the reserved bits if debug.
+func (r *RegisterSchema) Fprint(w io.Writer, val uint32, debug bool) {
+	indent, digits := "", 8
+	if r.core {
+		indent, digits = "  ", 4
+	}
+	label := r.Label
+	if label == "" {
+		label = r.Name
+	}
+	fmt.Fprintf(w, "%s%s : 0x%0*X\n", indent, label, digits, val)
+	fields := r.Fields
+	if debug {
+		fields = r.withReserved()
+	}
+	for _, f := range fields {
+		v := bitsOf(val, f.Hi, f.Lo)
+		s := strconv.Itoa(int(v))
+		if f.Hi != f.Lo && !r.dec(f.Name) {
+			s = fmt.Sprintf("0x%0*X", int(f.Hi-f.Lo)/4+1, v)
+		}
+		if note := r.Notes[f.Name]; note != "" {
+			s += " " + note
+		}
+		fmt.Fprintf(w, "%s  %-10s %s = %s\n", indent, "BIT["+f.Bits()+"]", f.Name, s)
+	}
+}
+
+func (r *RegisterSchema) dec(name string) bool {
+	for _, d := range r.Dec {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withReserved returns the fields with the gaps between them, most significant first.
+func (r *RegisterSchema) withReserved() []FieldSchema {
+	if len(r.Fields) == 0 {
+		return nil
+	}
+	fields := append([]FieldSchema(nil), r.Fields...)
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Hi > fields[j].Hi })
+	var all []FieldSchema
+	next := int(r.size()) - 1 // highest bit not described yet
+	for _, f := range fields {
+		if int(f.Hi) < next {
+			all = append(all, FieldSchema{Name: "Reserved", Hi: uint(next), Lo: f.Hi + 1})
+		}
+		all = append(all, f)
+		next = int(f.Lo) - 1
+	}
+	if next >= 0 {
+		all = append(all, FieldSchema{Name: "Reserved", Hi: uint(next), Lo: 0})
+	}
+	return all
+}
+
+// schema returns the register layouts of the model.
+func (m *ChipModel) schema() *Schema {
+	if m == nil || m.Schema == nil {
+		return DefaultSchema
+	}
+	return m.Schema
+}
+
+func (m *ChipModel) name() string {
+	if m == nil {
+		return ""
+	}
+	return m.Name
+}
@@ -0,0 +1,168 @@
+package bm13xx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDefaultSchema_Validate(t *testing.T) {
+	if err := DefaultSchema.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	data, err := json.Marshal(DefaultSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSchema(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(s, DefaultSchema, cmp.Exporter(func(reflect.Type) bool { return true })) {
+		t.Errorf("LoadSchema() = %v, want DefaultSchema", s)
+	}
+
+	bad := `{"registers":[{"name":"Foo","addr":0,"access":"rw","fields":[{"name":"A","bits":"7:0"},{"name":"B","bits":"4"}]}]}`
+	if _, err := LoadSchema(strings.NewReader(bad)); err == nil {
+		t.Errorf("LoadSchema() accepted overlapping fields")
+	}
+}
+
+func TestSchema_Register(t *testing.T) {
+	tests := []struct {
+		model string
+		addr  RegAddr
+		want  string
+	}{
+		{"BM1397", PLL0Parameter, "PLL0 Parameter"},
+		{"BM1387", BM1387GoldenNonce, "Golden Nonce"},
+		{"BM1387", BM1387ChipAddress, "Chip Address"},
+		{"", PLL0Parameter, "PLL0 Parameter"},
+		{"BM1366", VersionRolling, "Version Rolling"},
+		{"BM1397", VersionRolling, ""},
+	}
+	for _, tt := range tests {
+		var got string
+		if r := DefaultSchema.Register(tt.model, tt.addr); r != nil {
+			got = r.Name
+		}
+		if got != tt.want {
+			t.Errorf("Schema.Register(%q, 0x%02X) = %q, want %q", tt.model, byte(tt.addr), got, tt.want)
+		}
+	}
+}
+
+func TestRegisterSchema_Encode(t *testing.T) {
+	misc := DefaultSchema.Register("BM1397", MiscControl)
+	got, err := misc.Encode(map[string]uint32{"BT8D_4_0": 1, "TFS": 3, "RFS": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint32(0x00006131); got != want {
+		t.Errorf("RegisterSchema.Encode() = 0x%08X, want 0x%08X", got, want)
+	}
+	if _, err := misc.Encode(map[string]uint32{"TFS": 8}); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("RegisterSchema.Encode() error = %v, want ErrOutOfRange", err)
+	}
+	if _, err := misc.Encode(map[string]uint32{"FOO": 1}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RegisterSchema.Encode() error = %v, want ErrNotFound", err)
+	}
+	if err := misc.Check(got); err != nil {
+		t.Errorf("RegisterSchema.Check() error = %v", err)
+	}
+	if err := misc.Check(got | 1<<3); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("RegisterSchema.Check() error = %v, want ErrOutOfRange", err)
+	}
+}
+
+func TestFprintAsicReg(t *testing.T) {
+	tests := []struct {
+		name    string
+		regAddr RegAddr
+		regVal  uint32
+		debug   bool
+		want    string
+	}{
+		{
+			name:    "ErrorFlag debug",
+			regAddr: ErrorFlag,
+			regVal:  0x01020003,
+			debug:   true,
+			want: `Error Flag : 0x01020003
+  BIT[31:24] CMD_ERR_CNT = 0x01
+  BIT[23:16] WORK_ERR_CNT = 0x02
+  BIT[15:8]  Reserved = 0x00
+  BIT[7:0]   CORE_RESP_ERR = 0x03
+`,
+		},
+		{
+			name:    "I2CControl label",
+			regAddr: I2CControl,
+			regVal:  0x00000000,
+			want: `Some Temperature Related : 0x00000000
+  BIT[31]    BUSY = 0
+  BIT[26:25] SOME_FLAGS = 0x0
+  BIT[24]    DO_CMD = 0
+  BIT[23:17] I2C_ADDR = 0x00
+  BIT[16]    RD#_WR = 0
+  BIT[15:8]  I2C_REG_ADDR = 0x00
+  BIT[7:0]   I2C_REG_VAL = 0x00
+`,
+		},
+		{
+			name:    "PLL0Parameter decimal",
+			regAddr: PLL0Parameter,
+			regVal:  0xC0700111,
+			want: `PLL0 Parameter : 0xC0700111
+  BIT[31]    LOCKED = 1
+  BIT[30]    PLLEN = 1
+  BIT[27:16] FBDIV = 112
+  BIT[13:8]  REFDIV = 1
+  BIT[6:4]   POSTDIV1 = 1
+  BIT[2:0]   POSTDIV2 = 1
+  PLL0 Frequency : 2800 MHz
+`,
+		},
+		{
+			name:    "CoreRegisterControl unknown fields",
+			regAddr: CoreRegisterControl,
+			regVal:  0xFE05B274,
+			want: `Core Register Control : 0xFE05B274
+  BIT[31]    WR_RD#_MSB = 1
+  BIT[30:24] Always0x7e? = 0x7E
+  BIT[23:16] CORE_ID = 5
+  BIT[15]    WR_RD#_LSB = 1
+  BIT[14:12] Always3? = 3
+  BIT[11:8]  CORE_REG_ID = 2
+  BIT[7:0]   CORE_REG_VAL = 0x74
+  Process Monitor Data : 0x0074
+    BIT[15:0]  FREQ_CNT = 0x0074
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			FprintAsicReg(&b, tt.regAddr, tt.regVal, tt.debug)
+			if got := b.String(); got != tt.want {
+				t.Errorf("FprintAsicReg() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFprintAsicReg_note(t *testing.T) {
+	var b bytes.Buffer
+	FprintAsicReg(&b, MiscControl, 0x00013A01, false)
+	if want := "  BIT[16]    BCLK_SEL = 1 (=1 if baud>3_000_000)\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("FprintAsicReg() =\n%s\nwant a line %q", b.String(), want)
+	}
+}
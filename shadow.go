@@ -0,0 +1,108 @@
+package bm13xx
+
+import "fmt"
+
+// RegState tells how far the shadow of a register in Asic.Regs can be trusted.
+type RegState byte
+
+const (
+	RegUnknown  RegState = iota // neither read nor written
+	RegKnown                    // read from the chip
+	RegWritten                  // written, not read back since
+	RegVerified                 // written then read back as written
+	RegStale                    // the chip may have changed it, to be read again
+)
+
+func (s RegState) String() string {
+	switch s {
+	case RegUnknown:
+		return "unknown"
+	case RegKnown:
+		return "known"
+	case RegWritten:
+		return "written-unverified"
+	case RegVerified:
+		return "verified"
+	case RegStale:
+		return "stale"
+	}
+	return fmt.Sprintf("RegState(%d)", byte(s))
+}
+
+// State returns the state of the shadow of a register, known if the value
+// was set without state.
+func (a Asic) State(regAddr RegAddr) RegState {
+	if state, exist := a.States[regAddr]; exist {
+		return state
+	}
+	if _, exist := a.Regs[regAddr]; exist {
+		return RegKnown
+	}
+	return RegUnknown
+}
+
+func (a *Asic) setState(regAddr RegAddr, regVal uint32, state RegState) {
+	if a.Regs == nil {
+		a.Regs = make(map[RegAddr]uint32)
+	}
+	if a.States == nil {
+		a.States = make(map[RegAddr]RegState)
+	}
+	a.Regs[regAddr] = regVal
+	a.States[regAddr] = state
+}
+
+// shadowWrite applies a write to the shadow of the chips it targets. The read-only
+// bits keep their known value and the self-clearing ones are expected back to 0.
+// A failed write leaves the shadow stale, the chips may or may not have got it.
+// reqMu must be held, as for every change of Asics.
+func (c *Chain) shadowWrite(all bool, chipAddr byte, regAddr RegAddr, regVal uint32, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keep, clear uint32
+	if r := c.model.schema().Register(c.model.name(), regAddr); r != nil {
+		keep, clear = r.Mask(ReadOnly), r.Mask(SelfClearing)
+	}
+	for i := range c.Asics {
+		a := &c.Asics[i]
+		if !all && a.Addr() != chipAddr {
+			continue
+		}
+		old, exist := a.Regs[regAddr]
+		switch {
+		case failed && exist:
+			a.setState(regAddr, old, RegStale)
+		case failed:
+		default:
+			a.setState(regAddr, old&keep|regVal&^keep&^clear, RegWritten)
+		}
+	}
+}
+
+// MarkStale flags registers of a chip to be read again, like after a reset or
+// when they count or report a status. Every register if none given.
+func (c *Chain) MarkStale(chipIndex int, regAddrs ...RegAddr) error {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.markStale(chipIndex, regAddrs...)
+}
+
+func (c *Chain) markStale(chipIndex int, regAddrs ...RegAddr) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if chipIndex >= len(c.Asics) || chipIndex < 0 {
+		return fmt.Errorf("chipIndex %d %w", chipIndex, ErrOutOfRange)
+	}
+	a := &c.Asics[chipIndex]
+	if len(regAddrs) == 0 {
+		for regAddr := range a.Regs {
+			regAddrs = append(regAddrs, regAddr)
+		}
+	}
+	for _, regAddr := range regAddrs {
+		if regVal, exist := a.Regs[regAddr]; exist {
+			a.setState(regAddr, regVal, RegStale)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package bm13xx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot is a copy of the registers known of a chip at a given time.
+type Snapshot struct {
+	Time time.Time
+	Chip Asic
+}
+
+// FieldChange is a field whose value differs between two snapshots.
+type FieldChange struct {
+	Name string
+	Bits string
+	From uint32
+	To   uint32
+}
+
+// RegisterChange is a register whose value differs between two snapshots.
+type RegisterChange struct {
+	Name    string
+	Addr    byte // RegAddr, or CoreRegID for a core register
+	Core    bool
+	From    uint32
+	To      uint32
+	Added   bool // only known in the second snapshot
+	Removed bool // only known in the first snapshot
+	Fields  []FieldChange
+}
+
+// NewSnapshot copies the registers of a chip.
+func NewSnapshot(chip Asic) Snapshot {
+	return Snapshot{Time: time.Now(), Chip: chip.clone()}
+}
+
+// Snapshot copies the registers read so far of a chip.
+func (c *Chain) Snapshot(chipIndex int) (Snapshot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if chipIndex >= len(c.Asics) || chipIndex < 0 {
+		return Snapshot{}, fmt.Errorf("chipIndex %d %w", chipIndex, ErrOutOfRange)
+	}
+	return NewSnapshot(c.Asics[chipIndex]), nil
+}
+
+// Snapshots copies the registers of every chip at once.
+func (c *Chain) Snapshots() []Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snaps := make([]Snapshot, len(c.Asics))
+	now := time.Now()
+	for i, a := range c.Asics {
+		snaps[i] = Snapshot{Time: now, Chip: a.clone()}
+	}
+	return snaps
+}
+
+// Diff returns the registers which differ from a to b, registers first, in
+// address order. Snapshots of two chips or of the same chip at two times
+// can be compared alike.
+func Diff(a, b Snapshot) []RegisterChange {
+	var changes []RegisterChange
+	for _, addr := range regAddrs(a.Chip.Regs, b.Chip.Regs) {
+		from, inA := a.Chip.Regs[addr]
+		to, inB := b.Chip.Regs[addr]
+		if inA != inB || from != to {
+			changes = append(changes, change(DecodeAsicReg(a.Chip.Model, addr, from),
+				DecodeAsicReg(b.Chip.Model, addr, to), inA, inB))
+		}
+	}
+	for _, id := range coreRegIDs(a.Chip.CoreRegs, b.Chip.CoreRegs) {
+		from, inA := a.Chip.CoreRegs[id]
+		to, inB := b.Chip.CoreRegs[id]
+		if inA != inB || from != to {
+			changes = append(changes, change(DecodeCoreReg(a.Chip.Model, id, from),
+				DecodeCoreReg(b.Chip.Model, id, to), inA, inB))
+		}
+	}
+	return changes
+}
+
+// regAddrs returns the addresses of a and b, sorted.
+func regAddrs(a, b map[RegAddr]uint32) []RegAddr {
+	var addrs []RegAddr
+	for addr := range a {
+		addrs = append(addrs, addr)
+	}
+	for addr := range b {
+		if _, inA := a[addr]; !inA {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// coreRegIDs returns the core register IDs of a and b, sorted.
+func coreRegIDs(a, b map[CoreRegID]uint16) []CoreRegID {
+	var ids []CoreRegID
+	for id := range a {
+		ids = append(ids, id)
+	}
+	for id := range b {
+		if _, inA := a[id]; !inA {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func change(from, to RegisterDump, inA, inB bool) RegisterChange {
+	rc := RegisterChange{Name: to.Name, Addr: to.Addr, Core: to.Core, From: from.Value, To: to.Value,
+		Added: !inA, Removed: !inB}
+	if !inA || !inB {
+		return rc
+	}
+	for _, f := range to.Fields {
+		for _, g := range from.Fields {
+			if g.Name == f.Name && g.Value != f.Value {
+				rc.Fields = append(rc.Fields, FieldChange{Name: f.Name, Bits: f.Bits, From: g.Value, To: f.Value})
+			}
+		}
+	}
+	return rc
+}
+
+func (rc RegisterChange) String() string {
+	switch {
+	case rc.Added:
+		return fmt.Sprintf("%s : added 0x%08X", rc.Name, rc.To)
+	case rc.Removed:
+		return fmt.Sprintf("%s : removed 0x%08X", rc.Name, rc.From)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s : 0x%08X -> 0x%08X", rc.Name, rc.From, rc.To)
+	for _, f := range rc.Fields {
+		fmt.Fprintf(&sb, "\n  BIT[%s] %s = 0x%X -> 0x%X", f.Bits, f.Name, f.From, f.To)
+	}
+	return sb.String()
+}
@@ -0,0 +1,36 @@
+package bm13xx
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	a := NewSnapshot(Asic{
+		Model:    BM1397,
+		Regs:     map[RegAddr]uint32{ChipAddress: 0x13971800, MiscControl: 0x00003A01, TicketMask: 0},
+		CoreRegs: map[CoreRegID]uint16{CoreEnable: 0x00ff},
+	})
+	b := NewSnapshot(Asic{
+		Model: BM1397,
+		Regs: map[RegAddr]uint32{ChipAddress: 0x13971804, MiscControl: 0x00003A01, PLL0Parameter: 0xC0600161,
+			0x24: 0x00000001},
+		CoreRegs: map[CoreRegID]uint16{CoreEnable: 0x00fe},
+	})
+	want := []RegisterChange{
+		{Name: "Chip Address", Addr: 0x00, From: 0x13971800, To: 0x13971804,
+			Fields: []FieldChange{{Name: "ADDR", Bits: "7:0", From: 0x00, To: 0x04}}},
+		{Name: "PLL0 Parameter", Addr: 0x08, To: 0xC0600161, Added: true},
+		{Name: "Ticket Mask", Addr: 0x14, Removed: true},
+		{Name: "Unknown Register 0x24", Addr: 0x24, To: 0x00000001, Added: true},
+		{Name: "Core Enable", Addr: 0x04, Core: true, From: 0xff, To: 0xfe,
+			Fields: []FieldChange{{Name: "CORE_EN_I", Bits: "7:0", From: 0xff, To: 0xfe}}},
+	}
+	if got := Diff(a, b); !cmp.Equal(got, want) {
+		t.Errorf("Diff() mismatch (-got +want):\n%s", cmp.Diff(got, want))
+	}
+	if got := Diff(a, a); got != nil {
+		t.Errorf("Diff() of a snapshot with itself = %v, want nothing", got)
+	}
+}
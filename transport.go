@@ -0,0 +1,168 @@
+package bm13xx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ResetBaudrate is the speed of the chips UART after a reset.
+const ResetBaudrate = 115200
+
+// initBaudrate is the speed Init asks for once the chips are set.
+const initBaudrate = 1500000
+
+// drainDelay lets the frames sent at the old speed through before switching.
+const drainDelay = 10 * time.Millisecond
+
+// Transport is a port whose line speed the chain can change itself, like a
+// github.com/pkg/term Term. With a plain io.ReadWriter, the caller has to switch
+// the port to the baudrate returned by Init or SetBaudrate.
+type Transport interface {
+	io.ReadWriter
+	SetSpeed(baud int) error
+}
+
+// Baudrate returns the host port speed the chain runs at.
+func (c *Chain) Baudrate() uint32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.baud
+}
+
+func (c *Chain) setBaud(baud uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.baud = baud
+}
+
+// switchBaudrate sets the chips UART then, on a Transport, switches the host port
+// and checks the first chip still answers. Otherwise it sends the old UART
+// setting again at the new speed, in case the chips took it, and goes back to
+// the old speed. Between two fast UART settings (see BaudPlan.BClkSel) the
+// chips may still be lost, the chain must then be initialised again.
+func (c *Chain) switchBaudrate(ctx context.Context, baud uint32) (uint32, error) {
+	if len(c.Asics) == 0 {
+		return 0, fmt.Errorf("no asic enumerated %w", ErrInvalidState)
+	}
+	t, ok := c.port.(Transport)
+	if !ok {
+		newBaud, err := c.setBaudrate(ctx, baud)
+		if err != nil {
+			return 0, err
+		}
+		c.setBaud(newBaud)
+		return newBaud, nil
+	}
+	oldBaud := c.Baudrate()
+	old, err := c.uartRegs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	newBaud, err := c.setBaudrate(ctx, baud)
+	if err != nil {
+		return 0, err
+	}
+	switched := false
+	err = c.drain(ctx)
+	if err == nil {
+		err = t.SetSpeed(int(newBaud))
+		switched = err == nil
+	}
+	if err == nil {
+		err = c.checkLink(ctx)
+	}
+	if err == nil {
+		c.setBaud(newBaud)
+		return newBaud, nil
+	}
+	return c.fallbackBaudrate(ctx, t, old, switched, oldBaud, newBaud, err)
+}
+
+// uartReg is a register value setting the chips UART.
+type uartReg struct {
+	regAddr RegAddr
+	regVal  uint32
+}
+
+// uartRegs returns the registers setting the chips UART, MiscControl last as
+// it is the one switching the speed.
+func (c *Chain) uartRegs(ctx context.Context) ([]uartReg, error) {
+	miscAddr := c.model.Reg(MiscControl)
+	misc, err := c.firstChipReg(ctx, miscAddr)
+	if err != nil {
+		return nil, err
+	}
+	var regs []uartReg
+	var miscCtrl MiscControlReg
+	miscCtrl.Decode(misc)
+	if c.model != BM1387 && miscCtrl.BClkSel {
+		for _, regAddr := range []RegAddr{PLL3Parameter, FastUARTConfiguration} {
+			regVal, err := c.firstChipReg(ctx, regAddr)
+			if err != nil {
+				return nil, err
+			}
+			regs = append(regs, uartReg{regAddr, regVal})
+		}
+	}
+	return append(regs, uartReg{miscAddr, misc}), nil
+}
+
+// fallbackBaudrate puts the chips UART and the host port back to the old speed
+// after verr, and checks the first chip answers again.
+func (c *Chain) fallbackBaudrate(ctx context.Context, t Transport, old []uartReg, switched bool,
+	oldBaud, newBaud uint32, verr error) (uint32, error) {
+	if !switched {
+		// the chips took the new setting, the host follows them to restore it
+		switched = t.SetSpeed(int(newBaud)) == nil
+	}
+	for _, reg := range old {
+		c.writeRegister(true, 0, reg.regAddr, reg.regVal)
+	}
+	// the host goes back even when ctx is done, once the old setting is through
+	c.drain(context.Background())
+	if err := t.SetSpeed(int(oldBaud)); err != nil {
+		if switched {
+			c.setBaud(newBaud)
+		}
+		return 0, err
+	}
+	for i := range c.Asics {
+		c.markStale(i, c.model.Reg(MiscControl), PLL3Parameter, FastUARTConfiguration)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := c.checkLink(ctx); err != nil {
+		return 0, fmt.Errorf("chain lost at %d and %d bauds: %w", newBaud, oldBaud, err)
+	}
+	return oldBaud, fmt.Errorf("no answer at %d bauds, back to %d: %w", newBaud, oldBaud, verr)
+}
+
+// drain waits for the frames sent to be through and drops what was received
+// meanwhile, garbled by a speed change.
+func (c *Chain) drain(ctx context.Context) error {
+	if err := sleep(ctx, drainDelay); err != nil {
+		return err
+	}
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	c.dec.Reset()
+	c.disp.mu.Lock()
+	c.disp.decStats = c.dec.Stats()
+	c.disp.mu.Unlock()
+	return nil
+}
+
+// checkLink reads the ChipAddress of the first chip back.
+func (c *Chain) checkLink(ctx context.Context) error {
+	regVal, err := c.readRegister(ctx, c.Asics[0].Addr(), ChipAddress)
+	if err != nil {
+		return err
+	}
+	if want := c.Asics[0].Regs[ChipAddress]; regVal != want {
+		return fmt.Errorf("ChipAddress 0x%08X instead of 0x%08X", regVal, want)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package bm13xx
+
+import "context"
+
+// WriteRegisterVerified writes a register then reads it back from every chip
+// written, all of them for a broadcast. Fields the chip changes on its own, like
+// PLL LOCKED, are not compared. A *VerifyError lists the chips which differ.
+func (c *Chain) WriteRegisterVerified(all bool, chipAddr byte, regAddr RegAddr, regVal uint32) error {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.writeRegisterVerified(context.Background(), all, chipAddr, regAddr, regVal)
+}
+
+func (c *Chain) WriteRegisterVerifiedContext(ctx context.Context, all bool, chipAddr byte, regAddr RegAddr, regVal uint32) error {
+	defer c.ensureListening()()
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	return c.writeRegisterVerified(ctx, all, chipAddr, regAddr, regVal)
+}
+
+func (c *Chain) writeRegisterVerified(ctx context.Context, all bool, chipAddr byte, regAddr RegAddr, regVal uint32) error {
+	// addresses taken before the write, which may change them
+	targets := map[int]byte{}
+	if all {
+		for i := range c.Asics {
+			targets[i] = c.Asics[i].Addr()
+		}
+	} else {
+		i, err := c.chipIndex(chipAddr)
+		if err != nil {
+			return err
+		}
+		targets[i] = chipAddr
+	}
+	if err := c.writeRegister(all, chipAddr, regAddr, regVal); err != nil {
+		return err
+	}
+	verr := &VerifyError{RegAddr: regAddr, Want: regVal, Mask: c.verifyMask(regAddr)}
+	for i := range c.Asics {
+		addr, targeted := targets[i]
+		if !targeted {
+			continue
+		}
+		got, err := c.readRegister(ctx, addr, regAddr)
+		if err != nil {
+			verr.Mismatches = append(verr.Mismatches, WriteMismatch{ChipAddr: addr, Err: err})
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if (got^regVal)&verr.Mask != 0 {
+			verr.Mismatches = append(verr.Mismatches, WriteMismatch{ChipAddr: addr, Got: got})
+			c.setReg(i, regAddr, got)
+		} else {
+			c.setRegState(i, regAddr, got, RegVerified)
+		}
+	}
+	if len(verr.Mismatches) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// verifyMask returns the bits of a register a read back must return as written,
+// all of them for a register the schema does not know.
+func (c *Chain) verifyMask(regAddr RegAddr) uint32 {
+	model := c.Model()
+	if r := model.schema().Register(model.name(), regAddr); r != nil {
+		return r.VerifyMask()
+	}
+	return 0xffffffff
+}